@@ -0,0 +1,346 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: aggregator/v1/aggregator.proto
+
+// Package disablers.aggregator.v1 is the gRPC form of the aggregator's
+// /analyze endpoint.
+
+package aggregatorpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AnalyzeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Text  string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	// Restricts the response to these keys and the ops needed for them.
+	Fields []string `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty"`
+	// Ops to skip for this request.
+	Disable []string `protobuf:"bytes,3,rep,name=disable,proto3" json:"disable,omitempty"`
+	// When non-empty, only these ops run.
+	Only []string `protobuf:"bytes,4,rep,name=only,proto3" json:"only,omitempty"`
+	// Per-request op options keyed by op name, as in /analyze, e.g.
+	// {"slugger": {"max_length": 20}}.
+	Options       map[string]*structpb.Struct `protobuf:"bytes,5,rep,name=options,proto3" json:"options,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeRequest) Reset() {
+	*x = AnalyzeRequest{}
+	mi := &file_aggregator_v1_aggregator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeRequest) ProtoMessage() {}
+
+func (x *AnalyzeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregator_v1_aggregator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeRequest.ProtoReflect.Descriptor instead.
+func (*AnalyzeRequest) Descriptor() ([]byte, []int) {
+	return file_aggregator_v1_aggregator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AnalyzeRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *AnalyzeRequest) GetFields() []string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *AnalyzeRequest) GetDisable() []string {
+	if x != nil {
+		return x.Disable
+	}
+	return nil
+}
+
+func (x *AnalyzeRequest) GetOnly() []string {
+	if x != nil {
+		return x.Only
+	}
+	return nil
+}
+
+func (x *AnalyzeRequest) GetOptions() map[string]*structpb.Struct {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type AnalyzeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Op values keyed by their output key, e.g. "slug".
+	Fields        *structpb.Struct     `protobuf:"bytes,1,opt,name=fields,proto3" json:"fields,omitempty"`
+	Degraded      bool                 `protobuf:"varint,2,opt,name=degraded,proto3" json:"degraded,omitempty"`
+	Skipped       []string             `protobuf:"bytes,3,rep,name=skipped,proto3" json:"skipped,omitempty"`
+	Ops           map[string]*OpStatus `protobuf:"bytes,4,rep,name=ops,proto3" json:"ops,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Partial       bool                 `protobuf:"varint,5,opt,name=partial,proto3" json:"partial,omitempty"`
+	CacheHit      bool                 `protobuf:"varint,6,opt,name=cache_hit,json=cacheHit,proto3" json:"cache_hit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeResponse) Reset() {
+	*x = AnalyzeResponse{}
+	mi := &file_aggregator_v1_aggregator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeResponse) ProtoMessage() {}
+
+func (x *AnalyzeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregator_v1_aggregator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeResponse.ProtoReflect.Descriptor instead.
+func (*AnalyzeResponse) Descriptor() ([]byte, []int) {
+	return file_aggregator_v1_aggregator_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AnalyzeResponse) GetFields() *structpb.Struct {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *AnalyzeResponse) GetDegraded() bool {
+	if x != nil {
+		return x.Degraded
+	}
+	return false
+}
+
+func (x *AnalyzeResponse) GetSkipped() []string {
+	if x != nil {
+		return x.Skipped
+	}
+	return nil
+}
+
+func (x *AnalyzeResponse) GetOps() map[string]*OpStatus {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+func (x *AnalyzeResponse) GetPartial() bool {
+	if x != nil {
+		return x.Partial
+	}
+	return false
+}
+
+func (x *AnalyzeResponse) GetCacheHit() bool {
+	if x != nil {
+		return x.CacheHit
+	}
+	return false
+}
+
+type OpStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One of ok, failed, skipped, timeout or fallback.
+	Status        string  `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string  `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	LatencyMs     float64 `protobuf:"fixed64,3,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpStatus) Reset() {
+	*x = OpStatus{}
+	mi := &file_aggregator_v1_aggregator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpStatus) ProtoMessage() {}
+
+func (x *OpStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregator_v1_aggregator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpStatus.ProtoReflect.Descriptor instead.
+func (*OpStatus) Descriptor() ([]byte, []int) {
+	return file_aggregator_v1_aggregator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *OpStatus) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *OpStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *OpStatus) GetLatencyMs() float64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+var File_aggregator_v1_aggregator_proto protoreflect.FileDescriptor
+
+const file_aggregator_v1_aggregator_proto_rawDesc = "" +
+	"\n" +
+	"\x1eaggregator/v1/aggregator.proto\x12\x17disablers.aggregator.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x8f\x02\n" +
+	"\x0eAnalyzeRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x16\n" +
+	"\x06fields\x18\x02 \x03(\tR\x06fields\x12\x18\n" +
+	"\adisable\x18\x03 \x03(\tR\adisable\x12\x12\n" +
+	"\x04only\x18\x04 \x03(\tR\x04only\x12N\n" +
+	"\aoptions\x18\x05 \x03(\v24.disablers.aggregator.v1.AnalyzeRequest.OptionsEntryR\aoptions\x1aS\n" +
+	"\fOptionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12-\n" +
+	"\x05value\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x05value:\x028\x01\"\xcf\x02\n" +
+	"\x0fAnalyzeResponse\x12/\n" +
+	"\x06fields\x18\x01 \x01(\v2\x17.google.protobuf.StructR\x06fields\x12\x1a\n" +
+	"\bdegraded\x18\x02 \x01(\bR\bdegraded\x12\x18\n" +
+	"\askipped\x18\x03 \x03(\tR\askipped\x12C\n" +
+	"\x03ops\x18\x04 \x03(\v21.disablers.aggregator.v1.AnalyzeResponse.OpsEntryR\x03ops\x12\x18\n" +
+	"\apartial\x18\x05 \x01(\bR\apartial\x12\x1b\n" +
+	"\tcache_hit\x18\x06 \x01(\bR\bcacheHit\x1aY\n" +
+	"\bOpsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x127\n" +
+	"\x05value\x18\x02 \x01(\v2!.disablers.aggregator.v1.OpStatusR\x05value:\x028\x01\"W\n" +
+	"\bOpStatus\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"latency_ms\x18\x03 \x01(\x01R\tlatencyMs2j\n" +
+	"\n" +
+	"Aggregator\x12\\\n" +
+	"\aAnalyze\x12'.disablers.aggregator.v1.AnalyzeRequest\x1a(.disablers.aggregator.v1.AnalyzeResponseb\x06proto3"
+
+var (
+	file_aggregator_v1_aggregator_proto_rawDescOnce sync.Once
+	file_aggregator_v1_aggregator_proto_rawDescData []byte
+)
+
+func file_aggregator_v1_aggregator_proto_rawDescGZIP() []byte {
+	file_aggregator_v1_aggregator_proto_rawDescOnce.Do(func() {
+		file_aggregator_v1_aggregator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_aggregator_v1_aggregator_proto_rawDesc), len(file_aggregator_v1_aggregator_proto_rawDesc)))
+	})
+	return file_aggregator_v1_aggregator_proto_rawDescData
+}
+
+var file_aggregator_v1_aggregator_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_aggregator_v1_aggregator_proto_goTypes = []any{
+	(*AnalyzeRequest)(nil),  // 0: disablers.aggregator.v1.AnalyzeRequest
+	(*AnalyzeResponse)(nil), // 1: disablers.aggregator.v1.AnalyzeResponse
+	(*OpStatus)(nil),        // 2: disablers.aggregator.v1.OpStatus
+	nil,                     // 3: disablers.aggregator.v1.AnalyzeRequest.OptionsEntry
+	nil,                     // 4: disablers.aggregator.v1.AnalyzeResponse.OpsEntry
+	(*structpb.Struct)(nil), // 5: google.protobuf.Struct
+}
+var file_aggregator_v1_aggregator_proto_depIdxs = []int32{
+	3, // 0: disablers.aggregator.v1.AnalyzeRequest.options:type_name -> disablers.aggregator.v1.AnalyzeRequest.OptionsEntry
+	5, // 1: disablers.aggregator.v1.AnalyzeResponse.fields:type_name -> google.protobuf.Struct
+	4, // 2: disablers.aggregator.v1.AnalyzeResponse.ops:type_name -> disablers.aggregator.v1.AnalyzeResponse.OpsEntry
+	5, // 3: disablers.aggregator.v1.AnalyzeRequest.OptionsEntry.value:type_name -> google.protobuf.Struct
+	2, // 4: disablers.aggregator.v1.AnalyzeResponse.OpsEntry.value:type_name -> disablers.aggregator.v1.OpStatus
+	0, // 5: disablers.aggregator.v1.Aggregator.Analyze:input_type -> disablers.aggregator.v1.AnalyzeRequest
+	1, // 6: disablers.aggregator.v1.Aggregator.Analyze:output_type -> disablers.aggregator.v1.AnalyzeResponse
+	6, // [6:7] is the sub-list for method output_type
+	5, // [5:6] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_aggregator_v1_aggregator_proto_init() }
+func file_aggregator_v1_aggregator_proto_init() {
+	if File_aggregator_v1_aggregator_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_aggregator_v1_aggregator_proto_rawDesc), len(file_aggregator_v1_aggregator_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_aggregator_v1_aggregator_proto_goTypes,
+		DependencyIndexes: file_aggregator_v1_aggregator_proto_depIdxs,
+		MessageInfos:      file_aggregator_v1_aggregator_proto_msgTypes,
+	}.Build()
+	File_aggregator_v1_aggregator_proto = out.File
+	file_aggregator_v1_aggregator_proto_goTypes = nil
+	file_aggregator_v1_aggregator_proto_depIdxs = nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	batchMaxItems = mustParseInt("BATCH_MAX_ITEMS", "1000")
+	// batchSlots bounds how many batch items are analysed at once across
+	// all batch requests, leaving headroom for interactive /analyze calls.
+	batchSlots = make(chan struct{}, max(mustParseInt("BATCH_WORKERS", "8"), 1))
+)
+
+// AnalyseItem is one text in a batch or stream request.
+type AnalyseItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type BatchRequest struct {
+	Items []AnalyseItem `json:"items"`
+	// Fields restricts every result to these keys, like ?fields=.
+	Fields []string `json:"fields,omitempty"`
+	// Options holds op settings for every item, keyed by op name, like
+	// AnalyseRequest.Options.
+	Options map[string]map[string]interface{} `json:"options,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []*AnalyseResponse `json:"results"`
+}
+
+// analyseItem analyses a single batch or stream item. Problems with the
+// item itself are reported in the result's Error rather than returned.
+func analyseItem(ctx context.Context, item AnalyseItem, opts AnalyseOptions) *AnalyseResponse {
+	if item.Text == "" {
+		return itemError(item.ID, "Text field is required")
+	}
+	response, err := analyse(ctx, item.Text, opts)
+	if err != nil {
+		return itemError(item.ID, err.Error())
+	}
+	response.ID = item.ID
+	return response
+}
+
+func itemError(id, msg string) *AnalyseResponse {
+	response := newAnalyseResponse(registry)
+	response.ID = id
+	response.Error = msg
+	response.Degraded = true
+	return response
+}
+
+// handleAnalyzeBatch analyses every item of a batch and returns the
+// results in the order of the items. At most BATCH_WORKERS items are in
+// flight at once across all batches.
+func handleAnalyzeBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := parseAnalyseOptions(r, registry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req BatchRequest
+	if err := decodeBody(r, "BatchRequest", &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := mergeFields(registry, &opts, req.Fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Batch results keep the v1 shape.
+	pinFields(registry, apiV1, &opts)
+
+	if err := registry.checkOpOptions(req.Options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.OpOptions = req.Options
+
+	if len(req.Items) == 0 {
+		http.Error(w, "Items field is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) > batchMaxItems {
+		http.Error(w, fmt.Sprintf("Too many items (max %d)", batchMaxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx, cancel, err := withRequestBudget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	results := make([]*AnalyseResponse, len(req.Items))
+	var wg sync.WaitGroup
+	for i, item := range req.Items {
+		select {
+		case batchSlots <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = itemError(item.ID, ctx.Err().Error())
+			continue
+		}
+		batchItems.Inc()
+
+		wg.Add(1)
+		go func(i int, item AnalyseItem) {
+			defer wg.Done()
+			defer func() { <-batchSlots }()
+			results[i] = analyseItem(ctx, item, opts)
+		}(i, item)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{Results: results})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchOptions(t *testing.T) {
+	useSluggerOp(t)
+	useTestOpenAPI(t)
+
+	body := `{"items": [{"id": "a", "text": "batch options a"}, {"id": "b", "text": "batch options b"}], "options": {"slugger": {"max_length": 9}}}`
+	rec := httptest.NewRecorder()
+	handleAnalyzeBatch(rec, httptest.NewRequest("POST", "/analyze/batch", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(resp.Results))
+	}
+	for _, result := range resp.Results {
+		if result["slug"] != "batch-opt" {
+			t.Errorf("item %v: slug = %v, want %q", result["id"], result["slug"], "batch-opt")
+		}
+	}
+
+	for _, options := range []string{
+		`{"nope": {"max_length": 9}}`,
+		`{"slugger": {"width": 9}}`,
+		`{"slugger": {"max_length": "9"}}`,
+		`{"slugger": {"max_length": 9.5}}`,
+	} {
+		body := `{"items": [{"id": "a", "text": "batch options a"}], "options": ` + options + `}`
+		rec := httptest.NewRecorder()
+		handleAnalyzeBatch(rec, httptest.NewRequest("POST", "/analyze/batch", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("options %s: status = %d, want 400", options, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states. The numeric values are exported as the
+// aggregator_breaker_state gauge.
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+type breakerState int
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// errBreakerOpen is returned instead of calling an op whose breaker is open.
+var errBreakerOpen = errors.New("circuit breaker open")
+
+var (
+	breakerFailureThreshold = mustParseInt("BREAKER_FAILURE_THRESHOLD", "5")
+	breakerOpenTimeout      = mustParseDuration("BREAKER_OPEN_TIMEOUT", "30s")
+)
+
+// circuitBreaker trips after a run of consecutive failed calls to a
+// downstream. While open, calls fail fast; once openTimeout has passed a
+// single probe is let through (half-open) and its outcome closes or
+// re-opens the breaker.
+type circuitBreaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers holds one circuit breaker per registered op.
+var breakers map[string]*circuitBreaker
+
+func newBreakers(reg *Registry) map[string]*circuitBreaker {
+	b := make(map[string]*circuitBreaker, len(reg.Ops))
+	for _, op := range reg.Ops {
+		b[op.Name] = &circuitBreaker{
+			name:        op.Name,
+			threshold:   breakerFailureThreshold,
+			openTimeout: breakerOpenTimeout,
+		}
+	}
+	return b
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by exactly one call to Record.
+func (b *circuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return errBreakerOpen
+		}
+		b.setState(breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return errBreakerOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Breaker outcomes passed to Record.
+const (
+	outcomeSuccess = iota
+	outcomeFailure
+	// outcomeIgnored is for calls abandoned for reasons unrelated to the
+	// downstream, such as the caller going away.
+	outcomeIgnored
+)
+
+func (b *circuitBreaker) Record(outcome int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	halfOpen := b.state == breakerHalfOpen
+	if halfOpen {
+		b.probing = false
+	}
+
+	switch outcome {
+	case outcomeSuccess:
+		b.failures = 0
+		if halfOpen {
+			b.setState(breakerClosed)
+		}
+	case outcomeFailure:
+		b.failures++
+		if halfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+			b.openedAt = time.Now()
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state == state {
+		return
+	}
+	log.Printf("Circuit breaker for %s: %s -> %s", b.name, b.state, state)
+	b.state = state
+	breakerTransitions.Inc(b.name, state.String())
+}
+
+type breakerStatus struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Failures int        `json:"consecutive_failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+func (b *circuitBreaker) Status() breakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := breakerStatus{Name: b.name, State: b.state.String(), Failures: b.failures}
+	if b.state != breakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// handleAdminBreakers lists the state of every op's circuit breaker.
+func handleAdminBreakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := make([]breakerStatus, 0, len(registry.Ops))
+	for _, op := range registry.Ops {
+		statuses = append(statuses, breakers[op.Name].Status())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
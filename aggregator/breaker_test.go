@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	b := &circuitBreaker{name: "test", threshold: 3, openTimeout: 50 * time.Millisecond}
+	record := func(outcome int) {
+		t.Helper()
+		if err := b.Allow(); err != nil {
+			t.Fatalf("%s: Allow: %v", b.State(), err)
+		}
+		b.Record(outcome)
+	}
+	wantState := func(want breakerState) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("state = %s, want %s", got, want)
+		}
+	}
+
+	// A success resets the run of failures.
+	record(outcomeFailure)
+	record(outcomeFailure)
+	record(outcomeSuccess)
+	record(outcomeFailure)
+	record(outcomeFailure)
+	wantState(breakerClosed)
+	record(outcomeFailure)
+	wantState(breakerOpen)
+	if err := b.Allow(); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("open: Allow = %v, want %v", err, errBreakerOpen)
+	}
+
+	// Once the timeout has passed, one probe at a time goes through, and
+	// a failed probe re-opens the breaker at once.
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("after timeout: Allow = %v", err)
+	}
+	wantState(breakerHalfOpen)
+	if err := b.Allow(); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("half-open, probe in flight: Allow = %v, want %v", err, errBreakerOpen)
+	}
+	b.Record(outcomeFailure)
+	wantState(breakerOpen)
+	if err := b.Allow(); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("re-opened: Allow = %v, want %v", err, errBreakerOpen)
+	}
+
+	// An ignored probe frees the slot without deciding anything.
+	time.Sleep(60 * time.Millisecond)
+	record(outcomeIgnored)
+	wantState(breakerHalfOpen)
+
+	// A successful probe closes the breaker.
+	record(outcomeSuccess)
+	wantState(breakerClosed)
+	for i := 0; i < 3; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("closed: Allow = %v", err)
+		}
+	}
+	if status := b.Status(); status.Failures != 0 || status.OpenedAt != nil {
+		t.Errorf("closed: status = %+v", status)
+	}
+}
+
+// While the breaker is open, callOp fails fast without calling the op.
+func TestCallOpSkipsOpenBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var up atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !up.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"key": "normalized", "value": "hello"}`))
+	}))
+	t.Cleanup(srv.Close)
+	useTestRegistry(t, OpConfig{Name: "normalizer", URL: srv.URL, Key: "normalized", Type: TypeString})
+	breakers["normalizer"] = &circuitBreaker{name: "normalizer", threshold: 2, openTimeout: 50 * time.Millisecond}
+	op, _ := registry.Op("normalizer")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := callOp(ctx, *op, "hello", nil, nil); err == nil {
+			t.Fatal("down op: got no error")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := callOp(ctx, *op, "hello", nil, nil); !errors.Is(err, errBreakerOpen) {
+			t.Fatalf("open: got %v, want %v", err, errBreakerOpen)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("op called %d times, want 2", n)
+	}
+
+	up.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	resp, err := callOp(ctx, *op, "hello", nil, nil)
+	if err != nil || resp.Value != "hello" {
+		t.Fatalf("probe: got %+v, %v", resp, err)
+	}
+	if state := breakers["normalizer"].State(); state != breakerClosed {
+		t.Errorf("after a successful probe: state = %s, want closed", state)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultCache holds recent non-degraded analysis results.
+var resultCache = newLRUCache(mustParseInt("CACHE_SIZE", "10000"), mustParseDuration("CACHE_TTL", "5m"))
+
+// cacheKey combines a hash of the text with the name and version of every
+// op that runs, so results are not shared across pipeline changes. Skipped
+// ops are part of the key too, as they are reported in the response.
+func cacheKey(reg *Registry, text string, plan analysisPlan) string {
+	sum := sha256.Sum256([]byte(text))
+	var b strings.Builder
+	b.WriteString(hex.EncodeToString(sum[:]))
+	for _, op := range reg.Ops {
+		switch {
+		case plan.excluded[op.Name]:
+		case plan.skipped[op.Name]:
+			b.WriteString("|-")
+			b.WriteString(op.Name)
+		default:
+			b.WriteString("|")
+			b.WriteString(op.Name)
+			b.WriteString("@")
+			b.WriteString(op.Version)
+			if options, ok := plan.options[op.Name]; ok {
+				// encoding/json sorts map keys, so equal options encode
+				// the same way.
+				encoded, _ := json.Marshal(options)
+				b.Write(encoded)
+			}
+		}
+	}
+	return b.String()
+}
+
+// lruCache is a size-bounded LRU cache whose entries also expire after a
+// TTL. A size of zero disables it.
+type lruCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key      string
+	value    *AnalyseResponse
+	expireAt time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached response for key. The response is shared and
+// must not be modified.
+func (c *lruCache) Get(key string) (*AnalyseResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expireAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lruCache) Add(key string, value *AnalyseResponse) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expireAt := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value = value
+		entry.expireAt = expireAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expireAt: expireAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Purge empties the cache and returns how many entries it held.
+func (c *lruCache) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.order.Len()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	return n
+}
+
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// handleAdminCachePurge empties the result cache.
+func handleAdminCachePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	purged := resultCache.Purge()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
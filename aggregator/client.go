@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpClient is shared by all downstream calls. It has no timeout of its
+// own: every call is bounded by the context it is given.
+var httpClient = &http.Client{}
+
+func callMicroservice(ctx context.Context, url string, text string, deps, options map[string]interface{}) (*OpResponse, error) {
+	payload := OpRequest{Text: &text, Deps: deps, Options: options}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url+"/op", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{Code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var opResp OpResponse
+	if err := json.Unmarshal(body, &opResp); err != nil {
+		return nil, err
+	}
+
+	if opResp.Error != "" {
+		return nil, &OpError{Message: opResp.Error}
+	}
+
+	return &opResp, nil
+}
+
+// statusError is returned when an op answers with a non-200 status.
+type statusError struct {
+	Code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("service returned status %d", e.Code)
+}
+
+var (
+	retryBackoff    = mustParseDuration("OP_RETRY_BACKOFF", "50ms")
+	retryMaxBackoff = mustParseDuration("OP_RETRY_MAX_BACKOFF", "1s")
+)
+
+// callOp calls op, retrying failed attempts up to op.Retries times with
+// capped exponential backoff and full jitter. /op calls are idempotent, so
+// any failure of the downstream itself is retried; errors reported by the
+// op in OpResponse.Error are not, as they would only repeat. Every attempt
+// goes through the op's circuit breaker and may be hedged.
+func callOp(ctx context.Context, op OpConfig, text string, deps, options map[string]interface{}) (*OpResponse, error) {
+	breaker := breakers[op.Name]
+
+	var lastErr error
+	for attempt := 0; attempt <= *op.Retries; attempt++ {
+		if attempt > 0 {
+			if !sleepContext(ctx, backoff(attempt, retryBackoff, retryMaxBackoff)) {
+				return nil, lastErr
+			}
+			opRetries.Inc(op.Name)
+		}
+
+		if err := breaker.Allow(); err != nil {
+			opCalls.Inc(op.Name, "breaker_open")
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w after %d attempts, last error: %v", err, attempt, lastErr)
+			}
+			return nil, err
+		}
+
+		resp, err := hedgers[op.Name].Call(ctx, func(ctx context.Context) (*OpResponse, error) {
+			return callAttempt(ctx, op, text, deps, options)
+		})
+		var opErr *OpError
+		switch {
+		case err == nil:
+			breaker.Record(outcomeSuccess)
+			opCalls.Inc(op.Name, "ok")
+			return resp, nil
+		case errors.As(err, &opErr):
+			// The op is up and answered; the input is at fault.
+			breaker.Record(outcomeSuccess)
+			opCalls.Inc(op.Name, "op_error")
+			return nil, err
+		case ctx.Err() != nil:
+			breaker.Record(outcomeIgnored)
+			return nil, err
+		}
+
+		breaker.Record(outcomeFailure)
+		opCalls.Inc(op.Name, "failed")
+		lastErr = err
+		if !retryable(err) {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// callAttempt makes a single call to op bounded by its configured timeout
+// as well as by ctx.
+func callAttempt(ctx context.Context, op OpConfig, text string, deps, options map[string]interface{}) (*OpResponse, error) {
+	opCtx, cancel := context.WithTimeout(ctx, op.Timeout.Duration)
+	defer cancel()
+
+	var resp *OpResponse
+	var err error
+	if conn, ok := grpcConns[op.Name]; ok {
+		resp, err = callGRPC(opCtx, conn, text, deps, options)
+	} else {
+		resp, err = callMicroservice(opCtx, op.URL, text, deps, options)
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", op.Timeout.Duration)
+	}
+	return resp, err
+}
+
+// retryable reports whether a failed attempt is worth repeating. Client
+// errors other than 429, their gRPC equivalents and callbacks to
+// addresses they may not reach would fail the same way again.
+func retryable(err error) bool {
+	if errors.Is(err, errCallbackAddress) {
+		return false
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+			codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented, codes.Unauthenticated:
+			return false
+		}
+	}
+	return true
+}
+
+// backoff returns a random delay in [0, min(limit, base*2^(attempt-1))).
+func backoff(attempt int, base, limit time.Duration) time.Duration {
+	d := limit
+	if shift := attempt - 1; shift < 32 {
+		if exp := base << shift; exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// sleepContext waits for d and reports whether it did so before ctx ended.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
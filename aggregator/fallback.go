@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// fallbackFunc computes an op's value in-process from the same text, deps
+// and options the remote op would have received.
+type fallbackFunc func(text string, deps, options map[string]interface{}) (interface{}, error)
+
+// fallbacks are in-process copies of the op algorithms, keyed by op name.
+// They must be kept in step with the op services.
+var fallbacks = map[string]fallbackFunc{
+	"normalizer":     fallbackNormalize,
+	"transliterator": fallbackTransliterate,
+	"slugger":        fallbackSlug,
+}
+
+// checkFallbacks rejects registries enabling a fallback for an op that
+// has no in-process implementation.
+func checkFallbacks(reg *Registry) error {
+	for _, op := range reg.Ops {
+		if _, ok := fallbacks[op.Name]; op.Fallback && !ok {
+			return fmt.Errorf("op %q: no in-process fallback available", op.Name)
+		}
+	}
+	return nil
+}
+
+// shouldFallback reports whether a failed call to op should be served by
+// its fallback. Errors the op itself reported mean the op is up and the
+// input is at fault, so the fallback would fail the same way.
+func shouldFallback(op OpConfig, err error) bool {
+	var opErr *OpError
+	return op.Fallback && !errors.As(err, &opErr)
+}
+
+func runFallback(op OpConfig, text string, deps, options map[string]interface{}) (interface{}, error) {
+	value, err := fallbacks[op.Name](text, deps, options)
+	if err != nil {
+		return nil, err
+	}
+	opFallbacks.Inc(op.Name)
+	return value, nil
+}
+
+// fallbackInput returns deps[key] when it is a non-empty string, and text
+// otherwise, mirroring how the ops pick their input.
+func fallbackInput(text string, deps map[string]interface{}, key string) (string, error) {
+	input := text
+	if dep, ok := deps[key].(string); ok && dep != "" {
+		input = dep
+	}
+	if input == "" {
+		return "", errors.New("no text provided")
+	}
+	if len(input) > 10000 {
+		return "", errors.New("input text too long (max 10000 characters)")
+	}
+	return input, nil
+}
+
+func fallbackNormalize(text string, deps, options map[string]interface{}) (interface{}, error) {
+	input, err := fallbackInput(text, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return normalizeText(input), nil
+}
+
+func fallbackTransliterate(text string, deps, options map[string]interface{}) (interface{}, error) {
+	input, err := fallbackInput(text, deps, "normalized")
+	if err != nil {
+		return nil, err
+	}
+	standard := "basic"
+	if value, ok := options["standard"].(string); ok {
+		standard = value
+	}
+	if standard == autoStandard {
+		language, ok := deps["language"].(string)
+		if !ok || language == "" {
+			return nil, fmt.Errorf("standard %q needs deps.language", autoStandard)
+		}
+		standard = "basic"
+		if languageStandard, ok := languageStandards[language]; ok {
+			standard = languageStandard
+		}
+	}
+	if _, ok := standards[standard]; !ok {
+		return nil, fmt.Errorf("unknown transliteration standard %q", standard)
+	}
+	return transliterateText(input, standard), nil
+}
+
+func fallbackSlug(text string, deps, options map[string]interface{}) (interface{}, error) {
+	input, err := fallbackInput(text, deps, "transliterated")
+	if err != nil {
+		return nil, err
+	}
+	maxLen := maxSlugLength
+	if value, ok := options["max_length"].(float64); ok {
+		maxLen = int(value)
+	}
+	if maxLen < 1 || maxLen > maxSlugLength {
+		return nil, fmt.Errorf("options.max_length must be between 1 and %d", maxSlugLength)
+	}
+	slug := generateSlug(input, maxLen)
+	if slug == "" {
+		return nil, errors.New("no valid characters found for slug generation")
+	}
+	return slug, nil
+}
+
+// Copied from normalizer/main.go. TestNormalizeTextMatchesNormalizer checks
+// that the copy still agrees with the normalizer.
+
+// normalizeText applies NFKC normalization, lowercasing, whitespace collapsing, and diacritic stripping
+func normalizeText(s string) string {
+	// NFKC normalization
+	imported := norm.NFKC.String(s)
+	// Lowercase
+	imported = strings.ToLower(imported)
+	// Collapse whitespace
+	imported = strings.Join(strings.Fields(imported), " ")
+	// Strip diacritics
+	imported = stripDiacritics(imported)
+	return imported
+}
+
+func stripDiacritics(s string) string {
+	t := norm.NFD.String(s)
+	out := make([]rune, 0, len(t))
+	for _, r := range t {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// Copied from transliterator/main.go.
+
+// transliterateText performs ASCII-ish transliteration with ligature replacement
+func transliterateText(s string, standard string) string {
+	// Apply the standard's mappings while letters such as й are still
+	// composed; they are applied again below once diacritics are gone
+	text := applyStandard(norm.NFC.String(s), standard)
+
+	// Normalize using NFD to decompose characters
+	normalized := norm.NFD.String(text)
+
+	// Replace common ligatures first
+	text = replaceLigatures(normalized)
+
+	// Remove diacritics by filtering out combining marks
+	text = removeDiacritics(text)
+
+	// Apply the standard's mappings before the generic ones
+	text = applyStandard(text, standard)
+
+	// Apply additional ASCII transliterations
+	text = applyASCIITransliterations(text)
+
+	return text
+}
+
+// replaceLigatures replaces common ligatures with ASCII equivalents
+func replaceLigatures(s string) string {
+	ligatures := map[string]string{
+		"æ": "ae", "Æ": "AE",
+		"œ": "oe", "Œ": "OE",
+		"ß": "ss",
+		"ﬀ": "ff", "ﬁ": "fi", "ﬂ": "fl",
+		"ﬃ": "ffi", "ﬄ": "ffl",
+		"ﬅ": "st", "ﬆ": "st",
+		"ij": "ij", "IJ": "IJ",
+		"ł": "l", "Ł": "L",
+		"ø": "o", "Ø": "O",
+		"đ": "d", "Đ": "D",
+		"þ": "th", "Þ": "TH",
+		"ð": "dh", "Ð": "DH",
+	}
+
+	result := s
+	for ligature, replacement := range ligatures {
+		result = strings.ReplaceAll(result, ligature, replacement)
+	}
+
+	return result
+}
+
+// removeDiacritics removes combining diacritical marks
+func removeDiacritics(s string) string {
+	t := transform.Chain(norm.NFD, transform.RemoveFunc(func(r rune) bool {
+		return unicode.Is(unicode.Mn, r) // Remove nonspacing marks
+	}), norm.NFC)
+
+	result, _, _ := transform.String(t, s)
+	return result
+}
+
+// applyASCIITransliterations applies additional character-to-ASCII mappings
+func applyASCIITransliterations(s string) string {
+	transliterations := map[rune]string{
+		'α': "a", 'β': "b", 'γ': "g", 'δ': "d", 'ε': "e",
+		'ζ': "z", 'η': "h", 'θ': "th", 'ι': "i", 'κ': "k",
+		'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o",
+		'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+		'υ': "u", 'φ': "ph", 'χ': "ch", 'ψ': "ps", 'ω': "w",
+		'Α': "A", 'Β': "B", 'Γ': "G", 'Δ': "D", 'Ε': "E",
+		'Ζ': "Z", 'Η': "H", 'Θ': "TH", 'Ι': "I", 'Κ': "K",
+		'Λ': "L", 'Μ': "M", 'Ν': "N", 'Ξ': "X", 'Ο': "O",
+		'Π': "P", 'Ρ': "R", 'Σ': "S", 'Τ': "T", 'Υ': "U",
+		'Φ': "PH", 'Χ': "CH", 'Ψ': "PS", 'Ω': "W",
+	}
+
+	var result strings.Builder
+	for _, r := range s {
+		if replacement, exists := transliterations[r]; exists {
+			result.WriteString(replacement)
+		} else {
+			result.WriteRune(r)
+		}
+	}
+
+	return result.String()
+}
+
+// transliterationStandard maps letters of one script to ASCII. Digraphs
+// are replaced before single letters. Tables are lowercase: an uppercase
+// letter gets its replacement capitalised, and a digraph keeps the case
+// of its letters (see matchCase).
+type transliterationStandard struct {
+	digraphs [][2]string
+	letters  map[rune]string
+}
+
+// standards are the transliteration standards a request can pick with
+// options.standard. "basic" only applies the generic mappings.
+var standards = map[string]transliterationStandard{
+	"basic": {},
+	// ELOT 743 for Greek, without the context-dependent rules.
+	"elot743": {
+		digraphs: [][2]string{
+			{"ου", "ou"}, {"αυ", "av"}, {"ευ", "ev"}, {"γγ", "ng"},
+		},
+		letters: map[rune]string{
+			'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e",
+			'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+			'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o",
+			'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+			'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+		},
+	},
+	// BGN/PCGN for Russian, without the apostrophes for hard and soft
+	// signs.
+	"bgn-pcgn": {
+		letters: map[rune]string{
+			'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d",
+			'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+			'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+			'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+			'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch",
+			'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+			'э': "e", 'ю': "yu", 'я': "ya",
+		},
+	},
+}
+
+// autoStandard asks for the standard of the text's language, from
+// deps.language, and "basic" for languages without one.
+const autoStandard = "auto"
+
+// languageStandards picks the standard for texts in a language when the
+// request asks for autoStandard.
+var languageStandards = map[string]string{
+	"el": "elot743",
+	"ru": "bgn-pcgn",
+}
+
+// applyStandard applies the named transliteration standard's mappings
+func applyStandard(s string, name string) string {
+	standard := standards[name]
+	if len(standard.digraphs) == 0 && len(standard.letters) == 0 {
+		return s
+	}
+
+	var result strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if replacement, n := matchDigraph(standard.digraphs, runes[i:]); n > 0 {
+			result.WriteString(matchCase(replacement, runes[i:i+n]))
+			i += n - 1
+			continue
+		}
+		r := runes[i]
+		lower := unicode.ToLower(r)
+		replacement, exists := standard.letters[lower]
+		if !exists {
+			result.WriteRune(r)
+			continue
+		}
+		if lower != r && replacement != "" {
+			replacement = strings.ToUpper(replacement[:1]) + replacement[1:]
+		}
+		result.WriteString(replacement)
+	}
+
+	return result.String()
+}
+
+// matchDigraph returns the replacement of the digraph that runes start
+// with, in any case, and the digraph's length in runes; 0 if none does.
+func matchDigraph(digraphs [][2]string, runes []rune) (string, int) {
+	for _, digraph := range digraphs {
+		from := []rune(digraph[0])
+		if len(from) > len(runes) {
+			continue
+		}
+		matched := true
+		for k, r := range from {
+			if unicode.ToLower(runes[k]) != r {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return digraph[1], len(from)
+		}
+	}
+	return "", 0
+}
+
+// matchCase gives a digraph's replacement the case of the letters it
+// replaces: uppercase when they all are, capitalised when only the first
+// one is.
+func matchCase(replacement string, from []rune) string {
+	if replacement == "" || !unicode.IsUpper(from[0]) {
+		return replacement
+	}
+	for _, r := range from[1:] {
+		if !unicode.IsUpper(r) {
+			return strings.ToUpper(replacement[:1]) + replacement[1:]
+		}
+	}
+	return strings.ToUpper(replacement)
+}
+
+// Copied from slugger/main.go.
+
+// maxSlugLength is the longest slug generated, and the default length.
+const maxSlugLength = 64
+
+var (
+	slugInvalidChars = regexp.MustCompile(`[^a-z0-9\s]+`)
+	slugAlphanumeric = regexp.MustCompile(`[a-z0-9]`)
+)
+
+// generateSlug creates a URL-friendly slug of at most maxLen characters from input text
+func generateSlug(s string, maxLen int) string {
+	// Convert to lowercase
+	text := strings.ToLower(s)
+
+	// Replace any non-alphanumeric characters with spaces
+	text = slugInvalidChars.ReplaceAllString(text, " ")
+
+	// Split into words and filter out empty strings
+	words := strings.Fields(text)
+	var validWords []string
+
+	for _, word := range words {
+		// Only keep words that contain alphanumeric characters
+		if slugAlphanumeric.MatchString(word) {
+			validWords = append(validWords, word)
+		}
+	}
+
+	if len(validWords) == 0 {
+		return ""
+	}
+
+	// Join words with hyphens
+	slug := strings.Join(validWords, "-")
+
+	// Ensure max maxLen characters
+	if len(slug) > maxLen {
+		// Try to truncate at word boundaries
+		slug = truncateSlugAtWordBoundary(slug, maxLen)
+
+		// If still too long, hard truncate
+		if len(slug) > maxLen {
+			slug = slug[:maxLen]
+			// Remove trailing hyphen if present
+			slug = strings.TrimSuffix(slug, "-")
+		}
+	}
+
+	// Clean up any edge cases (double hyphens, leading/trailing hyphens)
+	slug = cleanupSlug(slug)
+
+	return slug
+}
+
+// truncateSlugAtWordBoundary tries to truncate at the last complete word within the limit
+func truncateSlugAtWordBoundary(slug string, maxLen int) string {
+	if len(slug) <= maxLen {
+		return slug
+	}
+
+	// Find the last hyphen before the limit
+	truncated := slug[:maxLen]
+	lastHyphen := strings.LastIndex(truncated, "-")
+
+	if lastHyphen > 0 {
+		return slug[:lastHyphen]
+	}
+
+	return truncated
+}
+
+// cleanupSlug removes duplicate hyphens and trims leading/trailing hyphens
+func cleanupSlug(slug string) string {
+	// Remove duplicate hyphens
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+
+	// Trim leading and trailing hyphens
+	slug = strings.Trim(slug, "-")
+
+	return slug
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestNormalizeTextMatchesNormalizer runs the copy of normalizeText over
+// the normalizer's own test cases, so the two cannot drift apart.
+func TestNormalizeTextMatchesNormalizer(t *testing.T) {
+	data, err := os.ReadFile("../normalizer/testdata/normalize.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Text       string `json:"text"`
+		Normalized string `json:"normalized"`
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if got := normalizeText(c.Text); got != c.Normalized {
+			t.Errorf("normalizeText(%q) = %q, normalizer gives %q", c.Text, got, c.Normalized)
+		}
+	}
+}
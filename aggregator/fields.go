@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseFields splits comma-separated field lists and checks that every
+// field is the key of a registered op.
+func parseFields(reg *Registry, values []string) ([]string, error) {
+	var fields []string
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if _, ok := reg.byKey[field]; !ok {
+				return nil, fmt.Errorf("fields: unknown field %q", field)
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// mergeFields adds the fields given in a request body to those from the
+// query string.
+func mergeFields(reg *Registry, opts *AnalyseOptions, bodyFields []string) error {
+	fields, err := parseFields(reg, bodyFields)
+	if err != nil {
+		return err
+	}
+	opts.Fields = append(opts.Fields, fields...)
+	return nil
+}
+
+// Select restricts the fields a response reports to keys. An empty keys
+// reports every field.
+func (a *AnalyseResponse) Select(keys []string) {
+	if len(keys) == 0 {
+		a.selected = nil
+		return
+	}
+	a.selected = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		a.selected[key] = true
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// inflight collapses concurrent identical analyses into one.
+var inflight = &flightGroup{calls: make(map[string]*flightCall)}
+
+// flightGroup shares one execution of a function between all callers that
+// ask for the same key while it is running. Unlike a plain singleflight,
+// the execution is detached from the caller that started it: it is only
+// cancelled once every caller waiting on it has gone away.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	// deadline is the run's deadline, zero when it has none.
+	deadline time.Time
+	done     chan struct{}
+	resp     *AnalyseResponse
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+// Do runs fn for key, or waits for the run already in flight. fn gets a
+// context that keeps the starting caller's deadline but not its
+// cancellation. A caller only joins a run whose deadline is no earlier
+// than its own, so joining never cuts its budget; otherwise it starts a
+// run of its own, which later callers join instead. shared reports
+// whether the result came from another caller's run. If ctx ends first,
+// Do returns ctx.Err().
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(context.Context) (*AnalyseResponse, error)) (resp *AnalyseResponse, shared bool, err error) {
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if ok && !call.lasts(ctx) {
+		ok = false
+	}
+	if ok {
+		call.waiters++
+		g.mu.Unlock()
+		inflightShared.Inc()
+	} else {
+		runCtx := context.WithoutCancel(ctx)
+		var cancel context.CancelFunc
+		deadline, hasDeadline := ctx.Deadline()
+		if hasDeadline {
+			runCtx, cancel = context.WithDeadline(runCtx, deadline)
+		} else {
+			runCtx, cancel = context.WithCancel(runCtx)
+		}
+		call = &flightCall{deadline: deadline, done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = call
+		g.mu.Unlock()
+
+		go func() {
+			call.resp, call.err = fn(runCtx)
+			cancel()
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+
+	select {
+	case <-call.done:
+		return call.resp, ok, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody is left to use the result.
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ok, ctx.Err()
+	}
+}
+
+// lasts reports whether the run goes on at least as long as ctx may wait
+// for it.
+func (c *flightCall) lasts(ctx context.Context) bool {
+	if c.deadline.IsZero() {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !c.deadline.Before(deadline)
+}
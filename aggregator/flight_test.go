@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestRegistry points the aggregator at ops for the rest of the test.
+func useTestRegistry(t *testing.T, ops ...OpConfig) {
+	t.Helper()
+	for i := range ops {
+		retries := 0
+		ops[i].Retries = &retries
+		ops[i].Timeout.Duration = 5 * time.Second
+	}
+	reg, err := newRegistry(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedRegistry, savedSwitches := registry, switches
+	savedBreakers, savedHedgers := breakers, hedgers
+	savedCache := resultCache
+	t.Cleanup(func() {
+		registry, switches = savedRegistry, savedSwitches
+		breakers, hedgers = savedBreakers, savedHedgers
+		resultCache = savedCache
+	})
+	registry = reg
+	// Results cached by an earlier run of the test would hide the ops.
+	resultCache = newLRUCache(100, time.Minute)
+	if switches, err = newOpSwitches(reg); err != nil {
+		t.Fatal(err)
+	}
+	breakers = newBreakers(reg)
+	hedgers = newHedgers(reg)
+}
+
+// slowOp serves an op that answers value after delay.
+func slowOp(t *testing.T, key string, value interface{}, delay time.Duration) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(OpResponse{Key: key, Value: value})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// useSluggerOp registers a slugger whose max_length option cuts the slug.
+func useSluggerOp(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slug := strings.ReplaceAll(strings.ToLower(*req.Text), " ", "-")
+		if n, ok := req.Options["max_length"].(float64); ok && int(n) < len(slug) {
+			slug = slug[:int(n)]
+		}
+		json.NewEncoder(w).Encode(OpResponse{Key: "slug", Value: slug})
+	}))
+	t.Cleanup(srv.Close)
+	useTestRegistry(t, OpConfig{
+		Name: "slugger", URL: srv.URL, Key: "slug", Type: TypeString,
+		Options: map[string]OptionConfig{"max_length": {Type: TypeInteger}},
+	})
+}
+
+// A caller with a long budget must not inherit the short deadline of a
+// run already in flight for the same text.
+func TestAnalyseJoinKeepsCallerBudget(t *testing.T) {
+	useTestRegistry(t, OpConfig{
+		Name: "normalizer",
+		URL:  slowOp(t, "normalized", "hello", 200*time.Millisecond),
+		Key:  "normalized",
+		Type: TypeString,
+	})
+	text := "flight " + t.Name()
+
+	shortCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	shortDone := make(chan *AnalyseResponse)
+	go func() {
+		response, err := analyse(shortCtx, text, AnalyseOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		shortDone <- response
+	}()
+	// Let the short caller start the run.
+	time.Sleep(20 * time.Millisecond)
+
+	longCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	long, err := analyse(longCtx, text, AnalyseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if long.Partial || long.Ops["normalizer"].Status != StatusOK {
+		t.Errorf("5s caller: partial = %v, normalizer = %+v; want a complete run", long.Partial, long.Ops["normalizer"])
+	}
+	if got := long.Fields["normalized"]; got != "hello" {
+		t.Errorf("5s caller: normalized = %v, want hello", got)
+	}
+
+	if short := <-shortDone; short == nil || !short.Partial {
+		t.Errorf("100ms caller: got %+v, want a partial response", short)
+	}
+}
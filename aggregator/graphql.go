@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// graphqlSchema is built from the registry at startup.
+var graphqlSchema graphql.Schema
+
+// graphqlName matches valid GraphQL field names.
+var graphqlName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// jsonScalar carries object and array op values as they are.
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:         "JSON",
+	Description:  "Any JSON value.",
+	Serialize:    func(value interface{}) interface{} { return value },
+	ParseValue:   func(value interface{}) interface{} { return value },
+	ParseLiteral: func(valueAST ast.Value) interface{} { return nil },
+})
+
+var opStatusType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "OpStatus",
+	Fields: graphql.Fields{
+		"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"status":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"error":     &graphql.Field{Type: graphql.String},
+		"latencyMs": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+	},
+})
+
+type graphqlOpStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// graphqlAnalysis backs one analyze field. Its op field resolvers first
+// record which op they need and with which arguments, then all of them
+// share a single analysis restricted to those fields, run by the first
+// one that needs the result.
+type graphqlAnalysis struct {
+	ctx  context.Context
+	text string
+
+	mu   sync.Mutex
+	opts AnalyseOptions
+	// args holds the arguments each requested op was given, to catch
+	// conflicting ones.
+	args map[string]map[string]interface{}
+
+	once     sync.Once
+	response *AnalyseResponse
+	err      error
+}
+
+// request records that the query asks for op's field with args.
+func (a *graphqlAnalysis) request(op *OpConfig, args map[string]interface{}) error {
+	options := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if n, ok := value.(int); ok {
+			// Options travel as JSON, where numbers are float64.
+			value = float64(n)
+		}
+		options[snakeCase(name)] = value
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if previous, ok := a.args[op.Name]; ok {
+		if !reflect.DeepEqual(previous, options) {
+			return fmt.Errorf("%s is requested with conflicting arguments; one analysis runs each op once", op.Key)
+		}
+		return nil
+	}
+	a.args[op.Name] = options
+	a.opts.Fields = append(a.opts.Fields, op.Key)
+	if len(options) > 0 {
+		if a.opts.OpOptions == nil {
+			a.opts.OpOptions = make(map[string]map[string]interface{})
+		}
+		a.opts.OpOptions[op.Name] = options
+	}
+	return nil
+}
+
+// run analyses the text once for every field requested. When no op field
+// is requested, every op runs, as with /analyze.
+func (a *graphqlAnalysis) run() (*AnalyseResponse, error) {
+	a.once.Do(func() {
+		a.mu.Lock()
+		opts := a.opts
+		a.mu.Unlock()
+		if err := registry.checkOpOptions(opts.OpOptions); err != nil {
+			a.err = err
+			return
+		}
+		a.response, a.err = analyse(a.ctx, a.text, opts)
+	})
+	return a.response, a.err
+}
+
+// thunk defers reading the analysis until every field of the selection
+// has been recorded.
+func (a *graphqlAnalysis) thunk(read func(*AnalyseResponse) interface{}) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		response, err := a.run()
+		if err != nil {
+			return nil, err
+		}
+		return read(response), nil
+	}
+}
+
+// newGraphQLSchema maps every registered op onto a field of the Analysis
+// type, named after the op's key. The op's options become the field's
+// arguments, in camelCase.
+func newGraphQLSchema(reg *Registry) (graphql.Schema, error) {
+	statusField := func(typ graphql.Output, read func(*AnalyseResponse) interface{}) *graphql.Field {
+		return &graphql.Field{
+			Type: typ,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*graphqlAnalysis).thunk(read), nil
+			},
+		}
+	}
+	fields := graphql.Fields{
+		"degraded": statusField(graphql.NewNonNull(graphql.Boolean), func(r *AnalyseResponse) interface{} { return r.Degraded }),
+		"partial":  statusField(graphql.NewNonNull(graphql.Boolean), func(r *AnalyseResponse) interface{} { return r.Partial }),
+		"cacheHit": statusField(graphql.NewNonNull(graphql.Boolean), func(r *AnalyseResponse) interface{} { return r.CacheHit }),
+		"skipped": statusField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), func(r *AnalyseResponse) interface{} {
+			if r.Skipped == nil {
+				return []string{}
+			}
+			return r.Skipped
+		}),
+		"ops": statusField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(opStatusType))), func(r *AnalyseResponse) interface{} {
+			statuses := make([]graphqlOpStatus, 0, len(r.Ops))
+			for name, status := range r.Ops {
+				statuses = append(statuses, graphqlOpStatus{Name: name, Status: status.Status, Error: status.Error, LatencyMs: status.LatencyMs})
+			}
+			sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+			return statuses
+		}),
+	}
+
+	for i := range reg.Ops {
+		op := &reg.Ops[i]
+		if !graphqlName.MatchString(op.Key) {
+			return graphql.Schema{}, fmt.Errorf("op %q: key %q is not a valid GraphQL field name", op.Name, op.Key)
+		}
+		if _, ok := fields[op.Key]; ok {
+			return graphql.Schema{}, fmt.Errorf("op %q: key %q clashes with a GraphQL field", op.Name, op.Key)
+		}
+
+		args := graphql.FieldConfigArgument{}
+		for name, option := range op.Options {
+			args[camelCase(name)] = &graphql.ArgumentConfig{
+				Type:        graphqlInputType(option.Type),
+				Description: option.Description,
+			}
+		}
+		fields[op.Key] = &graphql.Field{
+			Type:        graphqlOutputType(op.Type),
+			Description: fmt.Sprintf("Value of the %s op; null when it was skipped or failed, with an error in the latter case.", op.Name),
+			Args:        args,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				analysis := p.Source.(*graphqlAnalysis)
+				if err := analysis.request(op, p.Args); err != nil {
+					return nil, err
+				}
+				return func() (interface{}, error) {
+					response, err := analysis.run()
+					if err != nil {
+						return nil, err
+					}
+					if status := response.Ops[op.Name]; status != nil && status.Error != "" && status.Status != StatusFallback {
+						return nil, fmt.Errorf("%s %s: %s", op.Name, status.Status, status.Error)
+					}
+					return response.Fields[op.Key], nil
+				}, nil
+			},
+		}
+	}
+
+	analysisType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Analysis",
+		Fields: fields,
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"analyze": &graphql.Field{
+				Type: graphql.NewNonNull(analysisType),
+				Args: graphql.FieldConfigArgument{
+					"text":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"disable": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+					"only":    &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+				},
+				Resolve: resolveAnalyze,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func resolveAnalyze(p graphql.ResolveParams) (interface{}, error) {
+	text, _ := p.Args["text"].(string)
+	if text == "" {
+		return nil, fmt.Errorf("text is required")
+	}
+	analysis := &graphqlAnalysis{ctx: p.Context, text: text, args: make(map[string]map[string]interface{})}
+	var err error
+	if analysis.opts.Disable, err = parseOpNames(registry, "disable", stringList(p.Args["disable"])); err != nil {
+		return nil, err
+	}
+	if analysis.opts.Only, err = parseOpNames(registry, "only", stringList(p.Args["only"])); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+func stringList(value interface{}) []string {
+	values, _ := value.([]interface{})
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func graphqlOutputType(typ string) graphql.Output {
+	switch typ {
+	case TypeString:
+		return graphql.String
+	case TypeNumber:
+		return graphql.Float
+	case TypeBool:
+		return graphql.Boolean
+	}
+	return jsonScalar
+}
+
+func graphqlInputType(typ string) graphql.Input {
+	switch typ {
+	case TypeInteger:
+		return graphql.Int
+	case TypeNumber:
+		return graphql.Float
+	case TypeBool:
+		return graphql.Boolean
+	}
+	return graphql.String
+}
+
+// camelCase turns an option name such as "max_length" into the GraphQL
+// argument name "maxLength".
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// snakeCase reverses camelCase.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// handleGraphQL serves GraphQL queries, POSTed as JSON or given in the
+// query string of a GET. X-Request-Timeout bounds the whole query.
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&requestCounter, 1)
+
+	var req graphqlRequest
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case "POST":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := withRequestBudget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        ctx,
+	})
+	if result.HasErrors() {
+		log.Printf("GraphQL query errors: %v", result.Errors)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
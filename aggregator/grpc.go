@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"op/aggregatorpb"
+	"op/oppb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcConns holds a client connection for every op whose URL is a grpc://
+// URL. Ops without one are called over HTTP.
+var grpcConns map[string]*grpc.ClientConn
+
+// newGRPCConns sets up the connections for the registry's gRPC ops. They
+// connect lazily, on the first call.
+func newGRPCConns(reg *Registry) (map[string]*grpc.ClientConn, error) {
+	conns := make(map[string]*grpc.ClientConn)
+	for _, op := range reg.Ops {
+		target, ok := strings.CutPrefix(op.URL, "grpc://")
+		if !ok {
+			continue
+		}
+		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, fmt.Errorf("op %q: %w", op.Name, err)
+		}
+		conns[op.Name] = conn
+	}
+	return conns, nil
+}
+
+// callGRPC is the gRPC counterpart of callMicroservice.
+func callGRPC(ctx context.Context, conn *grpc.ClientConn, text string, deps, options map[string]interface{}) (*OpResponse, error) {
+	req := &oppb.OpRequest{Text: &text}
+	var err error
+	if deps != nil {
+		if req.Deps, err = structpb.NewStruct(deps); err != nil {
+			return nil, err
+		}
+	}
+	if options != nil {
+		if req.Options, err = structpb.NewStruct(options); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := oppb.NewOpClient(conn).Run(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, &OpError{Message: resp.Error}
+	}
+	return &OpResponse{Key: resp.Key, Value: resp.Value.AsInterface(), CacheHit: resp.CacheHit}, nil
+}
+
+// aggregatorServer serves /analyze over gRPC.
+type aggregatorServer struct {
+	aggregatorpb.UnimplementedAggregatorServer
+}
+
+func (aggregatorServer) Analyze(ctx context.Context, in *aggregatorpb.AnalyzeRequest) (*aggregatorpb.AnalyzeResponse, error) {
+	atomic.AddInt64(&requestCounter, 1)
+
+	if in.Text == "" {
+		return nil, status.Error(codes.InvalidArgument, "Text field is required")
+	}
+	var opts AnalyseOptions
+	var err error
+	if opts.Fields, err = parseFields(registry, in.Fields); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if opts.Disable, err = parseOpNames(registry, "disable", in.Disable); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if opts.Only, err = parseOpNames(registry, "only", in.Only); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// disablers.aggregator.v1 answers like /v1/analyze.
+	pinFields(registry, apiV1, &opts)
+
+	if len(in.Options) > 0 {
+		opts.OpOptions = make(map[string]map[string]interface{}, len(in.Options))
+		for name, options := range in.Options {
+			opts.OpOptions[name] = options.AsMap()
+		}
+	}
+	if err := registry.checkOpOptions(opts.OpOptions); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// The call's deadline is the request budget, capped like
+	// X-Request-Timeout.
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > maxRequestTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxRequestTimeout)
+		defer cancel()
+	}
+
+	response, err := analyse(ctx, in.Text, opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return analyseResponseToProto(response)
+}
+
+func analyseResponseToProto(response *AnalyseResponse) (*aggregatorpb.AnalyzeResponse, error) {
+	out := &aggregatorpb.AnalyzeResponse{
+		Fields:   &structpb.Struct{Fields: make(map[string]*structpb.Value)},
+		Degraded: response.Degraded,
+		Skipped:  response.Skipped,
+		Ops:      make(map[string]*aggregatorpb.OpStatus, len(response.Ops)),
+		Partial:  response.Partial,
+		CacheHit: response.CacheHit,
+	}
+	err := response.eachField(func(key string, value interface{}) error {
+		v, err := structpb.NewValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		out.Fields.Fields[key] = v
+		return nil
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for name, op := range response.Ops {
+		out.Ops[name] = &aggregatorpb.OpStatus{Status: op.Status, Error: op.Error, LatencyMs: op.LatencyMs}
+	}
+	return out, nil
+}
+
+// serveGRPC serves the Aggregator service, the standard health service and
+// server reflection on addr.
+func serveGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	aggregatorpb.RegisterAggregatorServer(server, aggregatorServer{})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server.Serve(lis)
+}
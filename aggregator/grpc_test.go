@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"op/aggregatorpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGRPCAnalyzeOptions(t *testing.T) {
+	useSluggerOp(t)
+
+	options := func(op string, values map[string]interface{}) map[string]*structpb.Struct {
+		s, err := structpb.NewStruct(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]*structpb.Struct{op: s}
+	}
+	text := "grpc options " + t.Name()
+
+	resp, err := aggregatorServer{}.Analyze(context.Background(), &aggregatorpb.AnalyzeRequest{
+		Text:    text,
+		Options: options("slugger", map[string]interface{}{"max_length": 8}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Fields.Fields["slug"].GetStringValue(); got != "grpc-opt" {
+		t.Errorf("slug = %q, want %q", got, "grpc-opt")
+	}
+
+	tests := []struct {
+		name    string
+		options map[string]*structpb.Struct
+		want    string
+	}{
+		{"unknown op", options("nope", map[string]interface{}{"max_length": 8}), `unknown op "nope"`},
+		{"unknown option", options("slugger", map[string]interface{}{"width": 8}), `has no option "width"`},
+		{"wrong type", options("slugger", map[string]interface{}{"max_length": "8"}), "must be of type integer"},
+		{"fraction", options("slugger", map[string]interface{}{"max_length": 8.5}), "must be of type integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := aggregatorServer{}.Analyze(context.Background(), &aggregatorpb.AnalyzeRequest{Text: text, Options: tt.options})
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want InvalidArgument containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	hedgeEnabled    = mustParseBool("HEDGE_ENABLED", "false")
+	hedgePercentile = mustParseFloat("HEDGE_PERCENTILE", "95", 0, 100)
+	hedgeMaxRatio   = mustParseFloat("HEDGE_MAX_RATIO", "0.1", 0, 1)
+	hedgeMinSamples = mustParseInt("HEDGE_MIN_SAMPLES", "20")
+)
+
+// hedgeWindow is the number of recent latencies a hedger keeps per op.
+const hedgeWindow = 128
+
+// hedger sends a second, hedged call to an op when the first has not
+// answered within the HEDGE_PERCENTILE latency of its recent calls, and
+// uses whichever answers first. Hedges are paid for from a budget that
+// grows by HEDGE_MAX_RATIO per call, so they never add more than that
+// fraction of extra load.
+type hedger struct {
+	name    string
+	enabled bool
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	budget    float64
+}
+
+// hedgers holds one hedger per registered op.
+var hedgers map[string]*hedger
+
+func newHedgers(reg *Registry) map[string]*hedger {
+	h := make(map[string]*hedger, len(reg.Ops))
+	for _, op := range reg.Ops {
+		enabled := hedgeEnabled
+		if op.Hedge != nil {
+			enabled = *op.Hedge
+		}
+		h[op.Name] = &hedger{name: op.Name, enabled: enabled && hedgeMaxRatio > 0}
+	}
+	return h
+}
+
+// observe records the latency of a successful call.
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeWindow {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % hedgeWindow
+}
+
+// delay returns how long to wait before hedging, or false when there are
+// too few samples to tell.
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Every call earns a fraction of a hedge. The budget is capped so a
+	// long quiet spell cannot fund a burst of hedges.
+	h.budget = math.Min(h.budget+hedgeMaxRatio, math.Max(1, hedgeMaxRatio*hedgeWindow))
+
+	if len(h.latencies) < max(hedgeMinSamples, 1) {
+		return 0, false
+	}
+	sorted := slices.Clone(h.latencies)
+	slices.Sort(sorted)
+	idx := int(math.Ceil(hedgePercentile/100*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)], true
+}
+
+// take spends one hedge from the budget.
+func (h *hedger) take() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.budget < 1 {
+		return false
+	}
+	h.budget--
+	return true
+}
+
+type hedgeResult struct {
+	resp   *OpResponse
+	err    error
+	hedged bool
+}
+
+// Call runs call, hedging it if enabled. The first successful answer wins
+// and the other call is cancelled; if both fail, the last error is
+// returned.
+func (h *hedger) Call(ctx context.Context, call func(context.Context) (*OpResponse, error)) (*OpResponse, error) {
+	if !h.enabled {
+		return h.timed(ctx, call)
+	}
+	delay, ok := h.delay()
+	if !ok {
+		return h.timed(ctx, call)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	launch := func(hedged bool) {
+		go func() {
+			resp, err := h.timed(ctx, call)
+			results <- hedgeResult{resp: resp, err: err, hedged: hedged}
+		}()
+	}
+	launch(false)
+	pending := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.resp, r.err
+	case <-timer.C:
+		if h.take() {
+			opHedges.Inc(h.name)
+			launch(true)
+			pending++
+		}
+	}
+
+	var r hedgeResult
+	for ; pending > 0; pending-- {
+		r = <-results
+		var opErr *OpError
+		if r.err == nil || errors.As(r.err, &opErr) {
+			break
+		}
+	}
+	if r.hedged && r.err == nil {
+		opHedgeWins.Inc(h.name)
+	}
+	return r.resp, r.err
+}
+
+// timed runs call and records its latency when it succeeds.
+func (h *hedger) timed(ctx context.Context, call func(context.Context) (*OpResponse, error)) (*OpResponse, error) {
+	start := time.Now()
+	resp, err := call(ctx)
+	if err == nil {
+		h.observe(time.Since(start))
+	}
+	return resp, err
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setHedgeConfig overrides the HEDGE_* settings for one test.
+func setHedgeConfig(t *testing.T, percentile, maxRatio float64, minSamples int) {
+	t.Helper()
+	oldPercentile, oldRatio, oldSamples := hedgePercentile, hedgeMaxRatio, hedgeMinSamples
+	hedgePercentile, hedgeMaxRatio, hedgeMinSamples = percentile, maxRatio, minSamples
+	t.Cleanup(func() {
+		hedgePercentile, hedgeMaxRatio, hedgeMinSamples = oldPercentile, oldRatio, oldSamples
+	})
+}
+
+func TestHedgeDelayPercentile(t *testing.T) {
+	setHedgeConfig(t, 95, 0.1, 20)
+	h := &hedger{name: "test", enabled: true}
+
+	// Observed out of order, 1ms to 100ms.
+	for i := 0; i < 100; i++ {
+		if i == 19 {
+			if _, ok := h.delay(); ok {
+				t.Fatal("delay with 19 samples: ok = true, want false")
+			}
+		}
+		h.observe(time.Duration((i*37)%100+1) * time.Millisecond)
+	}
+	tests := []struct {
+		percentile float64
+		want       time.Duration
+	}{
+		{95, 95 * time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{0, 1 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		hedgePercentile = tt.percentile
+		got, ok := h.delay()
+		if !ok || got != tt.want {
+			t.Errorf("p%v: delay = %s, %v, want %s", tt.percentile, got, ok, tt.want)
+		}
+	}
+
+	// Only the last hedgeWindow latencies count.
+	for i := 0; i < hedgeWindow; i++ {
+		h.observe(time.Second)
+	}
+	hedgePercentile = 0
+	if got, _ := h.delay(); got != time.Second {
+		t.Errorf("after a full window of 1s: p0 = %s, want 1s", got)
+	}
+}
+
+func TestHedgeBudget(t *testing.T) {
+	setHedgeConfig(t, 95, 0.25, 0)
+	h := &hedger{name: "test", enabled: true}
+
+	// Each call earns a quarter of a hedge.
+	for i := 0; i < 3; i++ {
+		h.delay()
+	}
+	if h.take() {
+		t.Fatal("after 3 calls: take = true, want false")
+	}
+	h.delay()
+	if !h.take() {
+		t.Fatal("after 4 calls: take = false, want true")
+	}
+	if h.take() {
+		t.Fatal("budget spent: take = true, want false")
+	}
+
+	// A long run of calls saves up at most hedgeMaxRatio*hedgeWindow.
+	for i := 0; i < 10*hedgeWindow; i++ {
+		h.delay()
+	}
+	limit := int(hedgeMaxRatio * hedgeWindow)
+	for i := 0; i < limit; i++ {
+		if !h.take() {
+			t.Fatalf("take %d of %d failed", i+1, limit)
+		}
+	}
+	if h.take() {
+		t.Errorf("take %d: got true, want the budget capped at %d", limit+1, limit)
+	}
+}
+
+func TestHedgeCallUsesFasterAnswer(t *testing.T) {
+	setHedgeConfig(t, 95, 1, 20)
+	h := &hedger{name: "test", enabled: true}
+	for i := 0; i < 20; i++ {
+		h.observe(time.Millisecond)
+	}
+
+	var calls atomic.Int32
+	var cancelled atomic.Bool
+	resp, err := h.Call(context.Background(), func(ctx context.Context) (*OpResponse, error) {
+		if calls.Add(1) == 1 {
+			// The first call hangs until the hedge wins.
+			<-ctx.Done()
+			cancelled.Store(true)
+			return nil, ctx.Err()
+		}
+		return &OpResponse{Key: "normalized", Value: "hedged"}, nil
+	})
+	if err != nil || resp.Value != "hedged" {
+		t.Fatalf("Call = %+v, %v, want the hedged answer", resp, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !cancelled.Load() {
+		t.Error("the slow call was not cancelled")
+	}
+}
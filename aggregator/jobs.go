@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	jobsDir       = getEnv("JOBS_DIR", "/var/lib/aggregator/jobs")
+	jobsRetention = mustParseDuration("JOBS_RETENTION", "24h")
+	jobsMaxItems  = mustParseInt("JOBS_MAX_ITEMS", "100000")
+)
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobCancelled = "cancelled"
+)
+
+// jobSaveInterval is how often a running job's status record is written
+// out; results are appended to the results log as items finish.
+const jobSaveInterval = time.Second
+
+// jobs is nil when the job store could not be opened.
+var jobs *jobStore
+
+// jobOptions are the analysis options a job was submitted with.
+type jobOptions struct {
+	Disable []string `json:"disable,omitempty"`
+	Only    []string `json:"only,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+	// OpOptions are the request's op settings keyed by op name.
+	OpOptions map[string]map[string]interface{} `json:"op_options,omitempty"`
+	// Budget is the X-Request-Timeout given at submission; it applies to
+	// each item.
+	Budget Duration `json:"budget"`
+}
+
+// JobRequest is the body of POST /jobs.
+type JobRequest struct {
+	BatchRequest
+	// CallbackURL, when set, receives the finished job; see notify.
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// jobRecord is the persisted status of a job. It is kept small, since it
+// is rewritten while the job runs; the items and results have files of
+// their own (see jobStore).
+type jobRecord struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Completed  int        `json:"completed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Options    jobOptions `json:"options"`
+
+	CallbackURL string `json:"callback_url,omitempty"`
+	// DeliveryID identifies the callback delivery; it stays the same
+	// across retries and restarts so receivers can drop duplicates.
+	DeliveryID string `json:"delivery_id,omitempty"`
+	// Notified is set once the callback was delivered or dead-lettered.
+	Notified bool `json:"notified,omitempty"`
+}
+
+// JobStatus is what GET /jobs/{id} reports.
+type JobStatus struct {
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Total       int               `json:"total"`
+	Completed   int               `json:"completed"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Results     []json.RawMessage `json:"results,omitempty"`
+}
+
+// resultEntry is a line of a job's results log.
+type resultEntry struct {
+	Index  int             `json:"index"`
+	Result json.RawMessage `json:"result"`
+}
+
+type job struct {
+	mu    sync.Mutex
+	rec   jobRecord
+	items []AnalyseItem
+	// results holds one encoded AnalyseResponse per item, in item order;
+	// items not analysed yet are nil.
+	results []json.RawMessage
+	// log is the results log, open while the job runs.
+	log    *os.File
+	dirty  bool
+	cancel context.CancelFunc
+}
+
+func (j *job) Status(withResults bool) JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := JobStatus{
+		ID:          j.rec.ID,
+		Status:      j.rec.Status,
+		Total:       j.rec.Total,
+		Completed:   j.rec.Completed,
+		CreatedAt:   j.rec.CreatedAt,
+		UpdatedAt:   j.rec.UpdatedAt,
+		FinishedAt:  j.rec.FinishedAt,
+		CallbackURL: j.rec.CallbackURL,
+	}
+	if withResults {
+		status.Results = append([]json.RawMessage(nil), j.results...)
+	}
+	return status
+}
+
+func (j *job) finished() bool {
+	return j.rec.Status == JobDone || j.rec.Status == JobCancelled
+}
+
+// jobStore keeps jobs in memory and mirrors each of them to files in dir,
+// so that they survive a restart: the status record in <id>.json, the
+// items, written once at submission, in <id>.items, and the results in
+// <id>.results, a log with a line per finished item. Unfinished jobs are
+// resumed when the store is opened.
+type jobStore struct {
+	dir string
+
+	mu   sync.Mutex
+	jobs map[string]*job
+
+	deadLetters *deadLetterStore
+}
+
+func openJobStore(dir string) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	deadLetters, err := openDeadLetterStore(filepath.Join(dir, "webhooks"))
+	if err != nil {
+		return nil, err
+	}
+	s := &jobStore{dir: dir, jobs: make(map[string]*job), deadLetters: deadLetters}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var resume []*job
+	for _, path := range paths {
+		j, err := s.load(path)
+		if err != nil {
+			log.Printf("Jobs: skipping unreadable %s: %v", path, err)
+			continue
+		}
+		s.jobs[j.rec.ID] = j
+		if !j.finished() {
+			resume = append(resume, j)
+		} else if j.rec.CallbackURL != "" && !j.rec.Notified {
+			go s.notify(context.Background(), j)
+		}
+	}
+	log.Printf("Jobs: loaded %d jobs from %s, resuming %d", len(s.jobs), dir, len(resume))
+
+	for _, j := range resume {
+		if err := s.start(j); err != nil {
+			return nil, err
+		}
+	}
+	go s.janitor()
+	return s, nil
+}
+
+// load reads the job whose status record is at path.
+func (s *jobStore) load(path string) (*job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Records written before items and results had files of their own
+	// carry them inline.
+	var rec struct {
+		jobRecord
+		Items   []AnalyseItem     `json:"items"`
+		Results []json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	j := &job{rec: rec.jobRecord}
+	if rec.Items != nil {
+		return j, s.migrate(j, rec.Items, rec.Results)
+	}
+
+	data, err = os.ReadFile(s.itemsPath(j.rec.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.items); err != nil {
+		return nil, err
+	}
+	// The log may be ahead of the record; it has the last word.
+	j.results = make([]json.RawMessage, len(j.items))
+	j.rec.Completed = 0
+	if err := s.replay(j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// replay reads the job's results log into j.results. A last line cut
+// short by a crash is dropped from the log so that appending can go on.
+func (s *jobStore) replay(j *job) error {
+	path := s.resultsPath(j.rec.ID)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	valid := 0
+	for valid < len(data) {
+		end := bytes.IndexByte(data[valid:], '\n')
+		if end < 0 {
+			break
+		}
+		var entry resultEntry
+		if json.Unmarshal(data[valid:valid+end], &entry) != nil || entry.Index < 0 || entry.Index >= len(j.results) {
+			break
+		}
+		if j.results[entry.Index] == nil {
+			j.rec.Completed++
+		}
+		j.results[entry.Index] = entry.Result
+		valid += end + 1
+	}
+	if valid < len(data) {
+		log.Printf("Jobs: dropping %d bytes from the end of %s", len(data)-valid, path)
+		return os.Truncate(path, int64(valid))
+	}
+	return nil
+}
+
+// migrate moves the inline items and results of an old record to their
+// own files.
+func (s *jobStore) migrate(j *job, items []AnalyseItem, results []json.RawMessage) error {
+	j.items = items
+	j.results = make([]json.RawMessage, len(items))
+	j.rec.Completed = 0
+	if err := s.writeItems(j); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for i, result := range results {
+		// Pending items were saved as null, which decodes as "null".
+		if i >= len(items) || result == nil || string(result) == "null" {
+			continue
+		}
+		j.results[i] = result
+		j.rec.Completed++
+		line, err := json.Marshal(resultEntry{Index: i, Result: result})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(s.resultsPath(j.rec.ID), buf.Bytes()); err != nil {
+		return err
+	}
+	return s.save(j)
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Submit stores a new job and starts running it.
+func (s *jobStore) Submit(items []AnalyseItem, opts jobOptions, callbackURL string) (*job, error) {
+	now := time.Now().UTC()
+	j := &job{rec: jobRecord{
+		ID:        newJobID(),
+		Status:    JobQueued,
+		Total:     len(items),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Options:   opts,
+	}, items: items, results: make([]json.RawMessage, len(items))}
+	if callbackURL != "" {
+		j.rec.CallbackURL = callbackURL
+		j.rec.DeliveryID = newJobID()
+	}
+	err := s.writeItems(j)
+	if err == nil {
+		err = s.save(j)
+	}
+	if err == nil {
+		err = s.start(j)
+	}
+	if err != nil {
+		s.remove(j.rec.ID)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.jobs[j.rec.ID] = j
+	s.mu.Unlock()
+
+	jobsSubmitted.Inc()
+	return j, nil
+}
+
+func (s *jobStore) Get(id string) (*job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	return j, ok
+}
+
+// Cancel stops a job. Results computed so far are kept.
+func (s *jobStore) Cancel(j *job) {
+	j.mu.Lock()
+	if j.finished() {
+		j.mu.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	j.rec.Status = JobCancelled
+	j.rec.UpdatedAt = now
+	j.rec.FinishedAt = &now
+	j.dirty = true
+	cancel := j.cancel
+	j.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if err := s.save(j); err != nil {
+		log.Printf("Jobs: saving %s: %v", j.rec.ID, err)
+	}
+}
+
+// start opens the job's results log and runs the job.
+func (s *jobStore) start(j *job) error {
+	resultsLog, err := os.OpenFile(s.resultsPath(j.rec.ID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.mu.Lock()
+	j.log = resultsLog
+	j.cancel = cancel
+	j.mu.Unlock()
+	go s.run(ctx, j)
+	return nil
+}
+
+// run analyses the job's remaining items on the batch worker pool, then
+// delivers the job to its callback URL if it has one.
+func (s *jobStore) run(ctx context.Context, j *job) {
+	defer s.notify(context.Background(), j)
+	defer j.cancel()
+	defer func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if err := j.log.Close(); err != nil {
+			log.Printf("Jobs: closing results of %s: %v", j.rec.ID, err)
+		}
+		j.log = nil
+	}()
+
+	j.mu.Lock()
+	if j.finished() {
+		j.mu.Unlock()
+		return
+	}
+	j.rec.Status = JobRunning
+	j.rec.UpdatedAt = time.Now().UTC()
+	j.dirty = true
+	items := j.items
+	pending := make([]bool, len(items))
+	for i := range items {
+		pending[i] = j.results[i] == nil
+	}
+	opts := AnalyseOptions{
+		Disable:   j.rec.Options.Disable,
+		Only:      j.rec.Options.Only,
+		Fields:    j.rec.Options.Fields,
+		OpOptions: j.rec.Options.OpOptions,
+	}
+	budget := j.rec.Options.Budget.Duration
+	j.mu.Unlock()
+	s.saveLogged(j)
+
+	// Write progress out periodically rather than after every item.
+	stopSaving := make(chan struct{})
+	savingDone := make(chan struct{})
+	go func() {
+		defer close(savingDone)
+		ticker := time.NewTicker(jobSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.saveLogged(j)
+			case <-stopSaving:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+dispatch:
+	for i, item := range items {
+		if !pending[i] {
+			continue
+		}
+		select {
+		case batchSlots <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+		wg.Add(1)
+		go func(i int, item AnalyseItem) {
+			defer wg.Done()
+			defer func() { <-batchSlots }()
+
+			var itemCtx context.Context
+			var cancel context.CancelFunc
+			if budget > 0 {
+				itemCtx, cancel = context.WithTimeout(ctx, budget)
+			} else {
+				itemCtx, cancel = context.WithCancel(ctx)
+			}
+			defer cancel()
+
+			jobItems.Inc()
+			response := analyseItem(itemCtx, item, opts)
+			if ctx.Err() != nil {
+				// Cancelled: the job stops with what it had.
+				return
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				data, _ = json.Marshal(itemError(item.ID, err.Error()))
+			}
+
+			line, err := json.Marshal(resultEntry{Index: i, Result: data})
+			if err != nil {
+				return
+			}
+			line = append(line, '\n')
+
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			if _, err := j.log.Write(line); err != nil {
+				// The item is left pending and rerun when the job resumes.
+				log.Printf("Jobs: writing a result of %s: %v", j.rec.ID, err)
+				return
+			}
+			j.results[i] = data
+			j.rec.Completed++
+			j.rec.UpdatedAt = time.Now().UTC()
+			j.dirty = true
+		}(i, item)
+	}
+	wg.Wait()
+	close(stopSaving)
+	<-savingDone
+
+	j.mu.Lock()
+	if !j.finished() {
+		now := time.Now().UTC()
+		j.rec.Status = JobDone
+		j.rec.UpdatedAt = now
+		j.rec.FinishedAt = &now
+	}
+	j.dirty = true
+	j.mu.Unlock()
+	s.saveLogged(j)
+}
+
+func (s *jobStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *jobStore) itemsPath(id string) string {
+	return filepath.Join(s.dir, id+".items")
+}
+
+func (s *jobStore) resultsPath(id string) string {
+	return filepath.Join(s.dir, id+".results")
+}
+
+// writeItems writes the job's items to their file, once, at submission.
+func (s *jobStore) writeItems(j *job) error {
+	data, err := json.Marshal(j.items)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.itemsPath(j.rec.ID), data)
+}
+
+// save writes the job's status record atomically, after syncing the
+// results log so that the record never counts results the log may lose.
+func (s *jobStore) save(j *job) error {
+	j.mu.Lock()
+	data, err := json.Marshal(j.rec)
+	j.dirty = false
+	id := j.rec.ID
+	resultsLog := j.log
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if resultsLog != nil {
+		if err := resultsLog.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+	}
+	return writeFileAtomic(s.path(id), data)
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers
+// never see a partly written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveLogged saves the job if it changed since it was last saved.
+func (s *jobStore) saveLogged(j *job) {
+	j.mu.Lock()
+	dirty := j.dirty
+	j.mu.Unlock()
+	if !dirty {
+		return
+	}
+	if err := s.save(j); err != nil {
+		log.Printf("Jobs: saving %s: %v", j.rec.ID, err)
+	}
+}
+
+// janitor deletes finished jobs once they are older than JOBS_RETENTION.
+func (s *jobStore) janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.expire(time.Now().Add(-jobsRetention))
+	}
+}
+
+// expire deletes the jobs that finished before cutoff.
+func (s *jobStore) expire(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, j := range s.jobs {
+		j.mu.Lock()
+		expired := j.finished() && j.rec.FinishedAt != nil && j.rec.FinishedAt.Before(cutoff)
+		j.mu.Unlock()
+		if !expired {
+			continue
+		}
+		if err := s.remove(id); err != nil {
+			log.Printf("Jobs: removing %s: %v", id, err)
+			continue
+		}
+		delete(s.jobs, id)
+	}
+}
+
+// remove deletes a job's files, the status record last so that a job
+// is never loaded without its items.
+func (s *jobStore) remove(id string) error {
+	for _, path := range []string{s.resultsPath(id), s.itemsPath(id), s.path(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleJobs submits a job on POST /jobs. It takes the same body as
+// /analyze/batch and answers at once with the job's ID.
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if jobs == nil {
+		http.Error(w, "Jobs are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	opts, err := parseAnalyseOptions(r, registry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	budget, err := requestBudget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req JobRequest
+	if err := decodeBody(r, "JobRequest", &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := mergeFields(registry, &opts, req.Fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Job results keep the v1 shape.
+	pinFields(registry, apiV1, &opts)
+	if err := registry.checkOpOptions(req.Options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "Items field is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) > jobsMaxItems {
+		http.Error(w, fmt.Sprintf("Too many items (max %d)", jobsMaxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := checkCallbackURL(req.CallbackURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	j, err := jobs.Submit(req.Items, jobOptions{
+		Disable:   opts.Disable,
+		Only:      opts.Only,
+		Fields:    opts.Fields,
+		OpOptions: req.Options,
+		Budget:    Duration{budget},
+	}, req.CallbackURL)
+	if err != nil {
+		log.Printf("Jobs: submitting: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	status := j.Status(false)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+status.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleJob reports a job's progress and results on GET /jobs/{id} and
+// cancels it on POST /jobs/{id}/cancel.
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	if jobs == nil {
+		http.Error(w, "Jobs are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	j, ok := jobs.Get(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+	case action == "cancel" && r.Method == "POST":
+		jobs.Cancel(j)
+	case action == "" || action == "cancel":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j.Status(r.URL.Query().Get("results") != "false"))
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upperOp serves a normalizer that upper-cases its text after delay.
+func upperOp(t *testing.T, delay time.Duration) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(OpResponse{Key: "normalized", Value: strings.ToUpper(*req.Text)})
+	}))
+	t.Cleanup(srv.Close)
+	useTestRegistry(t, OpConfig{Name: "normalizer", URL: srv.URL, Key: "normalized", Type: TypeString})
+}
+
+// testItems returns n items whose texts are unique to the test.
+func testItems(t *testing.T, n int) []AnalyseItem {
+	items := make([]AnalyseItem, n)
+	for i := range items {
+		items[i] = AnalyseItem{ID: string(rune('a' + i)), Text: strings.ToLower(t.Name()) + " " + string(rune('a'+i))}
+	}
+	return items
+}
+
+// waitJob waits for j to leave the running states, and for its run to
+// let go of the results log.
+func waitJob(t *testing.T, j *job) JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j.mu.Lock()
+		done := j.finished() && j.log == nil
+		j.mu.Unlock()
+		if done {
+			return j.Status(true)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", j.rec.ID)
+	return JobStatus{}
+}
+
+// writeJob writes a job's files as a store would have left them.
+func writeJob(t *testing.T, dir string, rec jobRecord, items []AnalyseItem, results string) {
+	t.Helper()
+	write := func(name string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(rec.ID+".json", rec)
+	write(rec.ID+".items", items)
+	if err := os.WriteFile(filepath.Join(dir, rec.ID+".results"), []byte(results), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRecord(t *testing.T, dir, id string) jobRecord {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec jobRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// readResults decodes a results log, failing on any line that does not
+// parse.
+func readResults(t *testing.T, dir, id string) []resultEntry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, id+".results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []resultEntry
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			t.Fatalf("results log ends in a partial line %q", line)
+		}
+		var entry resultEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("results log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestJobStoreWritesAndReloads(t *testing.T) {
+	upperOp(t, 0)
+	dir := t.TempDir()
+	s, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := testItems(t, 3)
+	j, err := s.Submit(items, jobOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := waitJob(t, j)
+	if status.Status != JobDone || status.Completed != 3 || len(status.Results) != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	for i, result := range status.Results {
+		if want := strings.ToUpper(items[i].Text); !strings.Contains(string(result), want) {
+			t.Errorf("result %d = %s, want it to contain %q", i, result, want)
+		}
+	}
+
+	rec := readRecord(t, dir, j.rec.ID)
+	if rec.Status != JobDone || rec.Completed != 3 || rec.FinishedAt == nil {
+		t.Errorf("record = %+v", rec)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, j.rec.ID+".items"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var savedItems []AnalyseItem
+	if err := json.Unmarshal(data, &savedItems); err != nil || len(savedItems) != 3 || savedItems[2] != items[2] {
+		t.Errorf("items file = %s, %v", data, err)
+	}
+	if entries := readResults(t, dir, j.rec.ID); len(entries) != 3 {
+		t.Errorf("results log has %d lines, want 3", len(entries))
+	}
+
+	reopened, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := reopened.Get(j.rec.ID)
+	if !ok {
+		t.Fatal("job not loaded")
+	}
+	got := loaded.Status(true)
+	if got.Status != JobDone || got.Completed != 3 {
+		t.Errorf("reloaded status = %+v", got)
+	}
+	for i := range status.Results {
+		if string(got.Results[i]) != string(status.Results[i]) {
+			t.Errorf("reloaded result %d = %s, want %s", i, got.Results[i], status.Results[i])
+		}
+	}
+}
+
+// A results log whose last line was cut short by a crash loses that line,
+// and the resumed job appends after what was kept.
+func TestJobStoreDropsTornResult(t *testing.T) {
+	upperOp(t, 0)
+	dir := t.TempDir()
+	items := testItems(t, 3)
+	now := time.Now().UTC()
+	rec := jobRecord{ID: "torn", Status: JobRunning, Total: 3, Completed: 1, CreatedAt: now, UpdatedAt: now}
+	kept := `{"index":0,"result":{"id":"a","kept":true}}` + "\n" + `{"index":2,"result":{"id":"c","kept":true}}` + "\n"
+	writeJob(t, dir, rec, items, kept+`{"index":1,"res`)
+
+	// Replay alone, before the job is resumed.
+	s := &jobStore{dir: dir, jobs: make(map[string]*job)}
+	j, err := s.load(filepath.Join(dir, "torn.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.rec.Completed != 2 || j.results[1] != nil || j.results[2] == nil {
+		t.Errorf("replayed completed = %d, results = %q", j.rec.Completed, j.results)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "torn.results")); string(data) != kept {
+		t.Errorf("results log = %q, want %q", data, kept)
+	}
+
+	// Reopening resumes the job, which only reruns the missing item.
+	s, err = openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, _ = s.Get("torn")
+	status := waitJob(t, j)
+	if status.Status != JobDone || status.Completed != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	if !strings.Contains(string(status.Results[0]), `"kept":true`) || !strings.Contains(string(status.Results[2]), `"kept":true`) {
+		t.Errorf("kept results were rerun: %q", status.Results)
+	}
+	if want := strings.ToUpper(items[1].Text); !strings.Contains(string(status.Results[1]), want) {
+		t.Errorf("result 1 = %s, want it to contain %q", status.Results[1], want)
+	}
+	if entries := readResults(t, dir, "torn"); len(entries) != 3 || entries[2].Index != 1 {
+		t.Errorf("results log = %+v", entries)
+	}
+}
+
+// Records from before the items and results had files of their own are
+// split up when loaded.
+func TestJobStoreMigratesInlineResults(t *testing.T) {
+	dir := t.TempDir()
+	items := testItems(t, 3)
+	now := time.Now().UTC()
+	old := map[string]interface{}{
+		"id": "old", "status": JobDone, "total": 3, "completed": 2,
+		"created_at": now, "updated_at": now, "finished_at": now,
+		"items":   items,
+		"results": []json.RawMessage{json.RawMessage(`{"id":"a"}`), nil, json.RawMessage(`{"id":"c"}`)},
+	}
+	data, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, ok := s.Get("old")
+	if !ok {
+		t.Fatal("job not loaded")
+	}
+	status := j.Status(true)
+	if status.Completed != 2 || status.Results[1] != nil || string(status.Results[2]) != `{"id":"c"}` {
+		t.Errorf("status = %+v", status)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "old.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec["items"]; ok {
+		t.Error("record still carries its items")
+	}
+	if _, ok := rec["results"]; ok {
+		t.Error("record still carries its results")
+	}
+	entries := readResults(t, dir, "old")
+	if len(entries) != 2 || entries[0].Index != 0 || entries[1].Index != 2 {
+		t.Errorf("results log = %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.items")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJobStoreExpire(t *testing.T) {
+	dir := t.TempDir()
+	items := testItems(t, 1)
+	now := time.Now().UTC()
+	longAgo := now.Add(-48 * time.Hour)
+	for _, rec := range []jobRecord{
+		{ID: "expired", Status: JobDone, FinishedAt: &longAgo},
+		{ID: "cancelled", Status: JobCancelled, FinishedAt: &longAgo},
+		{ID: "recent", Status: JobDone, FinishedAt: &now},
+	} {
+		rec.Total, rec.Completed, rec.CreatedAt, rec.UpdatedAt = 1, 1, longAgo, longAgo
+		writeJob(t, dir, rec, items, `{"index":0,"result":{}}`+"\n")
+	}
+	s, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.expire(now.Add(-24 * time.Hour))
+	for id, want := range map[string]bool{"expired": false, "cancelled": false, "recent": true} {
+		if _, ok := s.Get(id); ok != want {
+			t.Errorf("%s kept = %v, want %v", id, ok, want)
+		}
+		for _, ext := range []string{".json", ".items", ".results"} {
+			if _, err := os.Stat(filepath.Join(dir, id+ext)); (err == nil) != want {
+				t.Errorf("%s%s exists = %v, want %v", id, ext, err == nil, want)
+			}
+		}
+	}
+}
+
+func TestJobStoreCancel(t *testing.T) {
+	upperOp(t, 200*time.Millisecond)
+	dir := t.TempDir()
+	s, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := s.Submit(testItems(t, 3*cap(batchSlots)), jobOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.Cancel(j)
+	status := waitJob(t, j)
+	if status.Status != JobCancelled || status.FinishedAt == nil || status.Completed == status.Total {
+		t.Fatalf("status = %+v", status)
+	}
+
+	// A second cancel changes nothing.
+	s.Cancel(j)
+	if again := j.Status(false); !again.FinishedAt.Equal(*status.FinishedAt) {
+		t.Errorf("FinishedAt moved from %s to %s", status.FinishedAt, again.FinishedAt)
+	}
+
+	if rec := readRecord(t, dir, j.rec.ID); rec.Status != JobCancelled {
+		t.Errorf("saved status = %s, want %s", rec.Status, JobCancelled)
+	}
+	reopened, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ := reopened.Get(j.rec.ID)
+	if got := loaded.Status(false); got.Status != JobCancelled || got.Completed != status.Completed {
+		t.Errorf("reloaded status = %+v, want cancelled with %d completed", got, status.Completed)
+	}
+}
+
+// A job's op options are saved with it and apply to every item, also
+// after a restart.
+func TestJobOptions(t *testing.T) {
+	useSluggerOp(t)
+	useTestOpenAPI(t)
+	dir := t.TempDir()
+	s, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := jobs
+	t.Cleanup(func() { jobs = saved })
+	jobs = s
+
+	body := `{"items": [{"id": "a", "text": "job options a"}], "options": {"slugger": {"max_length": 7}}}`
+	rec := httptest.NewRecorder()
+	handleJobs(rec, httptest.NewRequest("POST", "/jobs", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var submitted JobStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &submitted); err != nil {
+		t.Fatal(err)
+	}
+	j, _ := s.Get(submitted.ID)
+	status := waitJob(t, j)
+	if len(status.Results) != 1 || !strings.Contains(string(status.Results[0]), `"slug":"job-opt"`) {
+		t.Errorf("results = %s", status.Results)
+	}
+	if rec := readRecord(t, dir, submitted.ID); rec.Options.OpOptions["slugger"]["max_length"] != 7.0 {
+		t.Errorf("saved options = %+v", rec.Options)
+	}
+
+	rec = httptest.NewRecorder()
+	body = `{"items": [{"id": "a", "text": "job options a"}], "options": {"slugger": {"max_length": 7.5}}}`
+	handleJobs(rec, httptest.NewRequest("POST", "/jobs", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("fractional max_length: status = %d, want 400", rec.Code)
+	}
+}
@@ -3,51 +3,190 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"sync"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 type OpRequest struct {
-	Text *string `json:"text,omitempty"`
-	Deps *struct {
-		Normalized     *string  `json:"normalized,omitempty"`
-		Transliterated *string  `json:"transliterated,omitempty"`
-		Tokens         []string `json:"tokens,omitempty"`
-	} `json:"deps,omitempty"`
+	Text    *string                `json:"text,omitempty"`
+	Deps    map[string]interface{} `json:"deps,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
 }
 
 type OpResponse struct {
 	Key      string      `json:"key"`
 	Value    interface{} `json:"value"`
 	CacheHit bool        `json:"cache_hit"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// OpError is an error reported by an op in OpResponse.Error, as opposed to
+// a failure to reach the op.
+type OpError struct {
+	Message string
+}
+
+func (e *OpError) Error() string {
+	return e.Message
+}
+
+// Op statuses reported in AnalyseResponse.Ops.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	// StatusTimeout marks ops that had not finished when the request's
+	// deadline passed.
+	StatusTimeout = "timeout"
+	// StatusFallback marks ops whose remote call failed and whose value
+	// was computed in-process instead.
+	StatusFallback = "fallback"
+)
+
+// OpStatus describes how a single op fared during an analysis.
+type OpStatus struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
 }
 
 type AnalyseRequest struct {
 	Text string `json:"text"`
+	// Fields restricts the response to these keys, like ?fields=.
+	Fields []string `json:"fields,omitempty"`
+	// Options holds per-request op settings keyed by op name, e.g.
+	// {"slugger": {"max_length": 20}}.
+	Options map[string]map[string]interface{} `json:"options,omitempty"`
 }
 
+// AnalyseResponse holds one field per registered op plus the degraded
+// flag. It is encoded as a flat JSON object, e.g.
+// {"normalized": "...", "slug": "...", "degraded": false, "skipped": [],
+// "ops": {"slugger": {"status": "ok", "latency_ms": 1.2}}, "partial": false}.
 type AnalyseResponse struct {
-	Normalized     string `json:"normalized"`
-	Transliterated string `json:"transliterated"`
-	Slug           string `json:"slug"`
-	Degraded       bool   `json:"degraded"`
+	Fields   map[string]interface{}
+	Degraded bool
+	// Skipped lists the ops that were switched off and not called.
+	Skipped []string
+	// Ops maps op names to their status.
+	Ops map[string]*OpStatus
+	// Partial is set when the request's deadline passed before every op
+	// finished.
+	Partial bool
+	// ID echoes the caller's item ID in batch and stream results.
+	ID string
+	// Error explains why a batch or stream item could not be analysed.
+	Error string
+	// CacheHit is set when the response was served from the result cache.
+	CacheHit bool
+
+	registry *Registry
+	// selected, when set, limits the op fields that are reported.
+	selected map[string]bool
 }
 
-var (
-	normalizerURL     = getEnv("NORMALIZER_URL", "http://normalizer.disablers.svc.cluster.local:80")
-	transliteratorURL = getEnv("TRANSLITERATOR_URL", "http://transliterator.disablers.svc.cluster.local:80")
-	sluggerURL        = getEnv("SLUGGER_URL", "http://slugger.disablers.svc.cluster.local:80")
-	tokenizerURL      = getEnv("TOKENIZER_URL", "http://tokenizer.disablers.svc.cluster.local:80")
-	counterURL        = getEnv("COUNTER_URL", "http://counter.disablers.svc.cluster.local:80")
-	hasherURL         = getEnv("HASHER_URL", "http://hasher.disablers.svc.cluster.local:80")
-	entropyURL        = getEnv("ENTROPY_URL", "http://entropy.disablers.svc.cluster.local:80")
-	palindromeURL     = getEnv("PALINDROME_URL", "http://palindrome.disablers.svc.cluster.local:80")
-)
+func newAnalyseResponse(reg *Registry) *AnalyseResponse {
+	return &AnalyseResponse{
+		Fields:   make(map[string]interface{}, len(reg.Ops)),
+		Ops:      make(map[string]*OpStatus, len(reg.Ops)),
+		registry: reg,
+	}
+}
+
+// MarshalJSON emits the op fields in registry order, filling in the zero
+// value of the declared type for ops that produced nothing. ID and Error
+// are only emitted when set.
+func (a *AnalyseResponse) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if a.ID != "" {
+		if err := writeJSONField(&buf, "id", a.ID); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+	}
+	err := a.eachField(func(key string, value interface{}) error {
+		if err := writeJSONField(&buf, key, value); err != nil {
+			return err
+		}
+		buf.WriteByte(',')
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeJSONField(&buf, "degraded", a.Degraded); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(',')
+	skipped := a.Skipped
+	if skipped == nil {
+		skipped = []string{}
+	}
+	if err := writeJSONField(&buf, "skipped", skipped); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(',')
+	if err := writeJSONField(&buf, "ops", a.Ops); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(',')
+	if err := writeJSONField(&buf, "partial", a.Partial); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(',')
+	if err := writeJSONField(&buf, "cache_hit", a.CacheHit); err != nil {
+		return nil, err
+	}
+	if a.Error != "" {
+		buf.WriteByte(',')
+		if err := writeJSONField(&buf, "error", a.Error); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// eachField calls fn with every reported op field in registry order,
+// passing the zero value of the declared type for ops that produced
+// nothing.
+func (a *AnalyseResponse) eachField(fn func(key string, value interface{}) error) error {
+	for _, op := range a.registry.Ops {
+		if a.selected != nil && !a.selected[op.Key] {
+			continue
+		}
+		value, ok := a.Fields[op.Key]
+		if !ok {
+			value = zeroValue(op.Type)
+		}
+		if err := fn(op.Key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) error {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(v)
+	return nil
+}
+
+var registry *Registry
 
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -56,23 +195,133 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func mustParseDuration(key, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return d
+}
+
+func mustParseFloat(key, defaultValue string, min, max float64) float64 {
+	f, err := strconv.ParseFloat(getEnv(key, defaultValue), 64)
+	if err != nil || f < min || f > max {
+		log.Fatalf("%s: invalid value %q", key, getEnv(key, defaultValue))
+	}
+	return f
+}
+
+func mustParseBool(key, defaultValue string) bool {
+	b, err := strconv.ParseBool(getEnv(key, defaultValue))
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return b
+}
+
+func mustParseInt(key, defaultValue string) int {
+	n, err := strconv.Atoi(getEnv(key, defaultValue))
+	if err != nil || n < 0 {
+		log.Fatalf("%s: invalid value %q", key, getEnv(key, defaultValue))
+	}
+	return n
+}
+
 func main() {
+	var err error
+	registry, err = loadRegistry()
+	if err != nil {
+		log.Fatalf("Loading op registry: %v", err)
+	}
+	for _, op := range registry.Ops {
+		log.Printf("Registered op %s (%s) -> %s", op.Name, op.Key, op.URL)
+	}
+	switches, err = newOpSwitches(registry)
+	if err != nil {
+		log.Fatalf("Loading op switches: %v", err)
+	}
+	breakers = newBreakers(registry)
+	hedgers = newHedgers(registry)
+	grpcConns, err = newGRPCConns(registry)
+	if err != nil {
+		log.Fatalf("Connecting to gRPC ops: %v", err)
+	}
+	if err := checkFallbacks(registry); err != nil {
+		log.Fatalf("Loading op fallbacks: %v", err)
+	}
+	graphqlSchema, err = newGraphQLSchema(registry)
+	if err != nil {
+		log.Fatalf("Building GraphQL schema: %v", err)
+	}
+	openapiDoc, err = newOpenAPIDoc(registry)
+	if err != nil {
+		log.Fatalf("Building OpenAPI document: %v", err)
+	}
+	if openapiJSON, err = json.Marshal(openapiDoc); err != nil {
+		log.Fatalf("Encoding OpenAPI document: %v", err)
+	}
+	// Jobs are optional: without a writable JOBS_DIR, /jobs answers 503.
+	if jobs, err = openJobStore(jobsDir); err != nil {
+		log.Printf("Jobs disabled: %v", err)
+	}
+
 	http.HandleFunc("/analyze", handleAnalyze)
+	http.HandleFunc("/v1/analyze", handleAnalyzeVersion(apiV1))
+	http.HandleFunc("/v2/analyze", handleAnalyzeVersion(apiV2))
+	http.HandleFunc("/analyze/batch", handleAnalyzeBatch)
+	http.HandleFunc("/analyze/stream", handleAnalyzeStream)
+	http.HandleFunc("/graphql", handleGraphQL)
+	http.HandleFunc("/jobs", handleJobs)
+	http.HandleFunc("/jobs/", handleJob)
 	http.HandleFunc("/healthz", handleHealth)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+	http.HandleFunc("/admin/ops", requireAdmin(handleAdminOps))
+	http.HandleFunc("/admin/breakers", requireAdmin(handleAdminBreakers))
+	http.HandleFunc("/admin/cache/purge", requireAdmin(handleAdminCachePurge))
+	http.HandleFunc("/admin/webhooks/dead-letters", requireAdmin(handleAdminDeadLetters))
+	http.HandleFunc("/admin/webhooks/dead-letters/", requireAdmin(handleAdminDeadLetters))
+
+	go func() {
+		log.Println("Starting gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
 
 	log.Println("Starting server on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
+// handleAnalyze serves the version the Accept header asks for, v1 by
+// default.
 func handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	version, negotiated := negotiateVersion(r)
+	serveAnalyze(w, r, version, negotiated)
+}
+
+// serveAnalyze analyses one text and answers in the given version of the
+// contract. negotiated responses carry the version's media type.
+func serveAnalyze(w http.ResponseWriter, r *http.Request, version apiVersion, negotiated bool) {
+	start := time.Now()
+	// Increment request counter
+	atomic.AddInt64(&requestCounter, 1)
+	apiRequests.Inc(version.String())
+	setVersionHeaders(w, version)
+
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	opts, err := parseAnalyseOptions(r, registry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var req AnalyseRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := decodeBody(r, "AnalyseRequest", &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -81,210 +330,42 @@ func handleAnalyze(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := aggregateAnalysis(req.Text)
-	if err != nil {
-		log.Printf("Error aggregating analysis: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if err := mergeFields(registry, &opts, req.Fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	pinFields(registry, version, &opts)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func callMicroservice(url string, text string) (*OpResponse, error) {
-	payload := OpRequest{Text: &text}
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
+	if err := registry.checkOpOptions(req.Options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	opts.OpOptions = req.Options
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(url+"/op", "application/json", bytes.NewBuffer(jsonData))
+	ctx, cancel, err := withRequestBudget(r)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("service returned status %d", resp.StatusCode)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	defer cancel()
 
-	body, err := io.ReadAll(resp.Body)
+	response, err := analyse(ctx, req.Text, opts)
 	if err != nil {
-		return nil, err
+		log.Printf("Error aggregating analysis: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	var opResp OpResponse
-	if err := json.Unmarshal(body, &opResp); err != nil {
-		return nil, err
+	contentType := "application/json"
+	if negotiated {
+		contentType = version.mediaType()
 	}
-
-	return &opResp, nil
-}
-
-func aggregateAnalysis(text string) (*AnalyseResponse, error) {
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
-	response := &AnalyseResponse{
-		Degraded: false,
+	w.Header().Set("Content-Type", contentType)
+	if version == apiV2 {
+		json.NewEncoder(w).Encode(newAnalyseResponseV2(response, opts.Fields, time.Since(start)))
+		return
 	}
-
-	errors := make([]error, 0)
-
-	// Call normalizer service
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if resp, err := callMicroservice(normalizerURL, text); err == nil {
-			if normalized, ok := resp.Value.(string); ok {
-				mu.Lock()
-				response.Normalized = normalized
-				mu.Unlock()
-			}
-		} else {
-			mu.Lock()
-			errors = append(errors, fmt.Errorf("normalizer: %w", err))
-			mu.Unlock()
-		}
-	}()
-
-	// Call transliterator service
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if resp, err := callMicroservice(transliteratorURL, text); err == nil {
-			if transliterated, ok := resp.Value.(string); ok {
-				mu.Lock()
-				response.Transliterated = transliterated
-				mu.Unlock()
-			}
-		} else {
-			mu.Lock()
-			errors = append(errors, fmt.Errorf("transliterator: %w", err))
-			mu.Unlock()
-		}
-	}()
-
-	// Call slugger service
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if resp, err := callMicroservice(sluggerURL, text); err == nil {
-			if slug, ok := resp.Value.(string); ok {
-				mu.Lock()
-				response.Slug = slug
-				mu.Unlock()
-			}
-		} else {
-			mu.Lock()
-			errors = append(errors, fmt.Errorf("slugger: %w", err))
-			mu.Unlock()
-		}
-	}()
-
-	// // Call tokenizer service
-	// wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	if resp, err := callMicroservice(tokenizerURL, text); err == nil {
-	// 		if tokens, ok := resp.Value.(float64); ok {
-	// 			mu.Lock()
-	// 			response.Tokens = int(tokens)
-	// 			mu.Unlock()
-	// 		}
-	// 	} else {
-	// 		mu.Lock()
-	// 		errors = append(errors, fmt.Errorf("tokenizer: %w", err))
-	// 		mu.Unlock()
-	// 	}
-	// }()
-
-	// // Call counter service for unique words, bigrams, and unique chars
-	// wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	if resp, err := callMicroservice(counterURL, text); err == nil {
-	// 		if data, ok := resp.Value.(map[string]interface{}); ok {
-	// 			mu.Lock()
-	// 			if uniqueWords, ok := data["unique_words"].(float64); ok {
-	// 				response.UniqueWords = int(uniqueWords)
-	// 			}
-	// 			if bigramCount, ok := data["bigram_count"].(float64); ok {
-	// 				response.BigramCount = int(bigramCount)
-	// 			}
-	// 			if uniqueChars, ok := data["unique_chars"].(float64); ok {
-	// 				response.UniqueChars = int(uniqueChars)
-	// 			}
-	// 			mu.Unlock()
-	// 		}
-	// 	} else {
-	// 		mu.Lock()
-	// 		errors = append(errors, fmt.Errorf("counter: %w", err))
-	// 		mu.Unlock()
-	// 	}
-	// }()
-
-	// // Call hasher service
-	// wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	if resp, err := callMicroservice(hasherURL, text); err == nil {
-	// 		if hash, ok := resp.Value.(string); ok {
-	// 			mu.Lock()
-	// 			response.Hash64 = hash
-	// 			mu.Unlock()
-	// 		}
-	// 	} else {
-	// 		mu.Lock()
-	// 		errors = append(errors, fmt.Errorf("hasher: %w", err))
-	// 		mu.Unlock()
-	// 	}
-	// }()
-
-	// // Call entropy service
-	// wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	if resp, err := callMicroservice(entropyURL, text); err == nil {
-	// 		if entropy, ok := resp.Value.(float64); ok {
-	// 			mu.Lock()
-	// 			response.Entropy = entropy
-	// 			mu.Unlock()
-	// 		}
-	// 	} else {
-	// 		mu.Lock()
-	// 		errors = append(errors, fmt.Errorf("entropy: %w", err))
-	// 		mu.Unlock()
-	// 	}
-	// }()
-
-	// // Call palindrome service
-	// wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	if resp, err := callMicroservice(palindromeURL, text); err == nil {
-	// 		if palindrome, ok := resp.Value.(bool); ok {
-	// 			mu.Lock()
-	// 			response.Palindrome = palindrome
-	// 			mu.Unlock()
-	// 		}
-	// 	} else {
-	// 		mu.Lock()
-	// 		errors = append(errors, fmt.Errorf("palindrome: %w", err))
-	// 		mu.Unlock()
-	// 	}
-	// }()
-
-	wg.Wait()
-
-	if len(errors) > 0 {
-		response.Degraded = true
-		log.Printf("Some services failed: %v", errors)
-	}
-
-	return response, nil
+	json.NewEncoder(w).Encode(response)
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
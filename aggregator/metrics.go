@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Global request counter
+var requestCounter int64
+
+// counterVec is a counter partitioned by label values, written in the
+// Prometheus text format.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]int64)}
+}
+
+// Inc adds one to the series identified by values, given in the order of
+// the counter's labels.
+func (c *counterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *counterVec) Add(n int64, values ...string) {
+	key := strings.Join(values, "\x00")
+	c.mu.Lock()
+	c.values[key] += n
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, formatLabels(c.labels, strings.Split(key, "\x00")), c.values[key])
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	opCalls = newCounterVec("aggregator_op_calls_total",
+		"Calls to op services by result (ok, op_error, failed, breaker_open)", "op", "result")
+	opRetries = newCounterVec("aggregator_op_retries_total",
+		"Retried calls to op services", "op")
+	breakerTransitions = newCounterVec("aggregator_breaker_transitions_total",
+		"Circuit breaker state changes by the state entered", "op", "state")
+	opHedges = newCounterVec("aggregator_op_hedges_total",
+		"Hedged calls sent to op services", "op")
+	opHedgeWins = newCounterVec("aggregator_op_hedge_wins_total",
+		"Hedged calls that answered before the original call", "op")
+	opFallbacks = newCounterVec("aggregator_op_fallbacks_total",
+		"Op values computed in-process after the remote call failed", "op")
+	cacheLookups = newCounterVec("aggregator_cache_lookups_total",
+		"Result cache lookups by result (hit, miss)", "result")
+	inflightShared = newCounterVec("aggregator_inflight_shared_total",
+		"Analyses that joined an identical analysis already in flight")
+	batchItems = newCounterVec("aggregator_batch_items_total",
+		"Items analysed through /analyze/batch")
+	streamItems = newCounterVec("aggregator_stream_items_total",
+		"Items analysed through /analyze/stream")
+	jobsSubmitted = newCounterVec("aggregator_jobs_submitted_total",
+		"Jobs submitted through /jobs")
+	jobItems = newCounterVec("aggregator_job_items_total",
+		"Items analysed by jobs")
+	apiRequests = newCounterVec("aggregator_api_requests_total",
+		"Requests to /analyze by API version", "version")
+	webhookDeliveries = newCounterVec("aggregator_webhook_deliveries_total",
+		"Job callback delivery attempts by result (delivered, failed) and deliveries given up (dead_letter)", "result")
+)
+
+// counters lists the counters exposed on /metrics.
+var counters = []*counterVec{opCalls, opRetries, breakerTransitions, opHedges, opHedgeWins, opFallbacks, cacheLookups, inflightShared, batchItems, streamItems, jobsSubmitted, jobItems, apiRequests, webhookDeliveries}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count := atomic.LoadInt64(&requestCounter)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "# HELP aggregator_requests_total Total number of requests to /analyze endpoint\n")
+	fmt.Fprintf(w, "# TYPE aggregator_requests_total counter\n")
+	fmt.Fprintf(w, "aggregator_requests_total %d\n", count)
+
+	for _, c := range counters {
+		c.write(w)
+	}
+
+	fmt.Fprintf(w, "# HELP aggregator_cache_entries Entries in the result cache\n")
+	fmt.Fprintf(w, "# TYPE aggregator_cache_entries gauge\n")
+	fmt.Fprintf(w, "aggregator_cache_entries %d\n", resultCache.Len())
+
+	fmt.Fprintf(w, "# HELP aggregator_breaker_state Circuit breaker state per op (0 closed, 1 half-open, 2 open)\n")
+	fmt.Fprintf(w, "# TYPE aggregator_breaker_state gauge\n")
+	for _, op := range registry.Ops {
+		fmt.Fprintf(w, "aggregator_breaker_state{op=%q} %d\n", op.Name, breakers[op.Name].State())
+	}
+}
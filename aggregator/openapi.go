@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// openapiBase is the registry-independent part of the OpenAPI document.
+//
+//go:embed openapi.json
+var openapiBase []byte
+
+var (
+	// openapiDoc describes the service; requests are validated against
+	// its schemas.
+	openapiDoc *openapi3.T
+	// openapiJSON is openapiDoc as served on /openapi.json.
+	openapiJSON []byte
+)
+
+// newOpenAPIDoc completes the OpenAPI document with the registry: one
+// AnalyseResponse property per op key, the op names and keys, and each
+// op's options.
+func newOpenAPIDoc(reg *Registry) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openapiBase)
+	if err != nil {
+		return nil, err
+	}
+	schemas := doc.Components.Schemas
+
+	response := schemas["AnalyseResponse"].Value
+	options := schemas["OpOptions"].Value
+	opName := schemas["OpName"].Value
+	fieldKey := schemas["FieldKey"].Value
+	for _, op := range reg.Ops {
+		opName.Enum = append(opName.Enum, op.Name)
+		fieldKey.Enum = append(fieldKey.Enum, op.Key)
+
+		value := openapiOutputSchema(op.Type)
+		value.Description = fmt.Sprintf("Value of the %s op.", op.Name)
+		response.Properties[op.Key] = value.NewRef()
+		if op.SinceAPI <= int(apiV1) {
+			response.Required = append(response.Required, op.Key)
+		}
+
+		if len(op.Options) == 0 {
+			continue
+		}
+		opOptions := openapi3.NewObjectSchema()
+		opOptions.AdditionalProperties = openapi3.AdditionalProperties{Has: openapi3.Ptr(false)}
+		for name, option := range op.Options {
+			schema := openapiOptionSchema(option.Type)
+			schema.Description = option.Description
+			opOptions.Properties[name] = schema.NewRef()
+		}
+		options.Properties[op.Name] = opOptions.NewRef()
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func openapiOutputSchema(typ string) *openapi3.Schema {
+	switch typ {
+	case TypeString:
+		return openapi3.NewStringSchema()
+	case TypeNumber:
+		return openapi3.NewFloat64Schema()
+	case TypeBool:
+		return openapi3.NewBoolSchema()
+	case TypeArray:
+		return openapi3.NewArraySchema().WithItems(&openapi3.Schema{})
+	}
+	return openapi3.NewObjectSchema()
+}
+
+func openapiOptionSchema(typ string) *openapi3.Schema {
+	switch typ {
+	case TypeInteger:
+		return openapi3.NewIntegerSchema()
+	case TypeNumber:
+		return openapi3.NewFloat64Schema()
+	case TypeBool:
+		return openapi3.NewBoolSchema()
+	}
+	return openapi3.NewStringSchema()
+}
+
+// decodeBody reads r's body and decodes it with decodeJSON.
+func decodeBody(r *http.Request, schema string, v interface{}) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("Reading body: %v", err)
+	}
+	return decodeJSON(data, schema, v)
+}
+
+// decodeJSON validates data against the named schema of the OpenAPI
+// document and decodes it into v. Schema violations are reported with
+// the JSON path of the offending value, e.g. "$.items[2].text". v is
+// still decoded as far as possible when data is valid JSON, so that
+// stream errors can echo the item's ID.
+func decodeJSON(data []byte, schema string, v interface{}) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("Invalid JSON: %v", err)
+	}
+	decodeErr := json.Unmarshal(data, v)
+	if err := openapiDoc.Components.Schemas[schema].Value.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		return fmt.Errorf("Invalid request: %s", describeSchemaError(err))
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("Invalid request: %v", decodeErr)
+	}
+	return nil
+}
+
+// describeSchemaError lists every violation in err as "<path>: <reason>",
+// sorted by path.
+func describeSchemaError(err error) string {
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+	var messages []string
+	for _, err := range errs {
+		var schemaErr *openapi3.SchemaError
+		if errors.As(err, &schemaErr) {
+			reason := schemaErr.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("does not match %q", schemaErr.SchemaField)
+			}
+			messages = append(messages, jsonPath(schemaErr.JSONPointer())+": "+reason)
+			continue
+		}
+		var nested openapi3.MultiError
+		if errors.As(err, &nested) {
+			messages = append(messages, describeSchemaError(nested))
+			continue
+		}
+		messages = append(messages, err.Error())
+	}
+	sort.Strings(messages)
+	return strings.Join(messages, "; ")
+}
+
+// jsonPath turns a JSON pointer's tokens into a path such as
+// "$.deps.tokens[3]".
+func jsonPath(pointer []string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, token := range pointer {
+		if _, err := strconv.Atoi(token); err == nil {
+			b.WriteString("[" + token + "]")
+		} else {
+			b.WriteString("." + token)
+		}
+	}
+	return b.String()
+}
+
+// handleOpenAPI serves the OpenAPI document.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiJSON)
+}
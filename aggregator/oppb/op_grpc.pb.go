@@ -0,0 +1,128 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: op/v1/op.proto
+
+// Package disablers.op.v1 is the gRPC form of the /op endpoint every op
+// service serves. Messages mirror the JSON OpRequest and OpResponse.
+
+package oppb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Op_Run_FullMethodName = "/disablers.op.v1.Op/Run"
+)
+
+// OpClient is the client API for Op service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OpClient interface {
+	// Run computes the op's value. Like /op, problems with the input are
+	// reported in OpResponse.error rather than as a gRPC status.
+	Run(ctx context.Context, in *OpRequest, opts ...grpc.CallOption) (*OpResponse, error)
+}
+
+type opClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOpClient(cc grpc.ClientConnInterface) OpClient {
+	return &opClient{cc}
+}
+
+func (c *opClient) Run(ctx context.Context, in *OpRequest, opts ...grpc.CallOption) (*OpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OpResponse)
+	err := c.cc.Invoke(ctx, Op_Run_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OpServer is the server API for Op service.
+// All implementations must embed UnimplementedOpServer
+// for forward compatibility.
+type OpServer interface {
+	// Run computes the op's value. Like /op, problems with the input are
+	// reported in OpResponse.error rather than as a gRPC status.
+	Run(context.Context, *OpRequest) (*OpResponse, error)
+	mustEmbedUnimplementedOpServer()
+}
+
+// UnimplementedOpServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOpServer struct{}
+
+func (UnimplementedOpServer) Run(context.Context, *OpRequest) (*OpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedOpServer) mustEmbedUnimplementedOpServer() {}
+func (UnimplementedOpServer) testEmbeddedByValue()            {}
+
+// UnsafeOpServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OpServer will
+// result in compilation errors.
+type UnsafeOpServer interface {
+	mustEmbedUnimplementedOpServer()
+}
+
+func RegisterOpServer(s grpc.ServiceRegistrar, srv OpServer) {
+	// If the following call pancis, it indicates UnimplementedOpServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Op_ServiceDesc, srv)
+}
+
+func _Op_Run_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpServer).Run(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Op_Run_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpServer).Run(ctx, req.(*OpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Op_ServiceDesc is the grpc.ServiceDesc for Op service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Op_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "disablers.op.v1.Op",
+	HandlerType: (*OpServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Run",
+			Handler:    _Op_Run_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "op/v1/op.proto",
+}
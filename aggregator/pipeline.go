@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRequestTimeout caps the budget a client can ask for with
+// X-Request-Timeout.
+var maxRequestTimeout = mustParseDuration("MAX_REQUEST_TIMEOUT", "30s")
+
+// requestBudget reads the overall deadline from the X-Request-Timeout
+// header, given either as a duration ("750ms", "2s") or as a number of
+// milliseconds. It returns 0 when the header is absent.
+func requestBudget(r *http.Request) (time.Duration, error) {
+	value := r.Header.Get("X-Request-Timeout")
+	if value == "" {
+		return 0, nil
+	}
+	budget, err := time.ParseDuration(value)
+	if err != nil {
+		ms, convErr := strconv.ParseUint(value, 10, 63)
+		if convErr != nil {
+			return 0, fmt.Errorf("invalid X-Request-Timeout %q", value)
+		}
+		budget = time.Duration(ms) * time.Millisecond
+	}
+	if budget <= 0 {
+		return 0, fmt.Errorf("invalid X-Request-Timeout %q", value)
+	}
+	if budget > maxRequestTimeout {
+		budget = maxRequestTimeout
+	}
+	return budget, nil
+}
+
+// withRequestBudget derives the context for an analysis from r, bounded by
+// the X-Request-Timeout budget when one is given.
+func withRequestBudget(r *http.Request) (context.Context, context.CancelFunc, error) {
+	budget, err := requestBudget(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if budget > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	return ctx, cancel, nil
+}
+
+// buildDeps collects the values of the dependencies keys into the deps
+// payload, narrowed to their DepField, with their DepExtras next to them,
+// when the providing op has one. Dependencies that produced nothing are
+// left out so the op falls back to the raw text.
+func buildDeps(reg *Registry, keys []string, outputs map[string]interface{}) map[string]interface{} {
+	var deps map[string]interface{}
+	for _, key := range keys {
+		value, ok := outputs[key]
+		if !ok {
+			continue
+		}
+		provider := reg.byKey[key]
+		var object map[string]interface{}
+		if provider.DepField != "" {
+			object, _ = value.(map[string]interface{})
+			if value, ok = object[provider.DepField]; !ok {
+				continue
+			}
+		}
+		if deps == nil {
+			deps = make(map[string]interface{}, len(keys))
+		}
+		deps[key] = value
+		for name, member := range provider.DepExtras {
+			if extra, ok := object[member]; ok {
+				deps[name] = extra
+			}
+		}
+	}
+	return deps
+}
+
+// analyse answers an analysis from the result cache when it can, and runs
+// aggregateAnalysis otherwise. Concurrent identical analyses share a single
+// run, and responses that are not degraded are cached.
+func analyse(ctx context.Context, text string, opts AnalyseOptions) (*AnalyseResponse, error) {
+	plan := switches.Plan(registry, opts)
+	key := cacheKey(registry, text, plan)
+	if cached, ok := resultCache.Get(key); ok {
+		cacheLookups.Inc("hit")
+		response := *cached
+		response.CacheHit = true
+		response.Select(opts.Fields)
+		return &response, nil
+	}
+	cacheLookups.Inc("miss")
+
+	shared, _, err := inflight.Do(ctx, key, func(ctx context.Context) (*AnalyseResponse, error) {
+		response, err := aggregateAnalysis(ctx, text, plan)
+		if err == nil && !response.Degraded {
+			resultCache.Add(key, response)
+		}
+		return response, err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// This caller gave up before the shared run finished.
+			response := timedOutResponse(plan, ctx.Err())
+			response.Select(opts.Fields)
+			return response, nil
+		}
+		return nil, err
+	}
+	// The shared response must not be modified; callers get a copy.
+	response := *shared
+	response.Select(opts.Fields)
+	return &response, nil
+}
+
+// timedOutResponse reports every op that was meant to run as timed out.
+func timedOutResponse(plan analysisPlan, err error) *AnalyseResponse {
+	response := newAnalyseResponse(registry)
+	for _, op := range registry.Ops {
+		if plan.excluded[op.Name] {
+			continue
+		}
+		if plan.skipped[op.Name] {
+			response.Skipped = append(response.Skipped, op.Name)
+			response.Ops[op.Name] = &OpStatus{Status: StatusSkipped}
+			continue
+		}
+		response.Ops[op.Name] = &OpStatus{Status: StatusTimeout, Error: err.Error()}
+	}
+	response.Partial = true
+	response.Degraded = true
+	return response
+}
+
+// aggregateAnalysis runs every registered op as a node in a dependency
+// graph: an op starts as soon as the ops it depends on have finished, so
+// independent ops run concurrently. Ops the plan skips are not called and
+// are reported as skipped; their dependants fall back to the raw text. Ops
+// the plan excludes are neither called nor reported.
+//
+// Every downstream call is bound to ctx. If ctx ends before all ops have
+// finished, the ops that did finish are returned, the rest are reported
+// with StatusTimeout and the response is marked partial.
+func aggregateAnalysis(ctx context.Context, text string, plan analysisPlan) (*AnalyseResponse, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	response := newAnalyseResponse(registry)
+
+	errors := make([]error, 0)
+	// finished is set once the response has been handed back; ops that
+	// complete afterwards are dropped.
+	finished := false
+	started := make(map[string]time.Time, len(registry.Ops))
+
+	// Every op gets a channel that is closed once it has finished, so
+	// dependants can wait on it.
+	done := make(map[string]chan struct{}, len(registry.Ops))
+	for _, op := range registry.Ops {
+		done[op.Key] = make(chan struct{})
+	}
+
+	for _, op := range registry.Ops {
+		if plan.excluded[op.Name] {
+			// Nothing needed depends on an excluded op.
+			close(done[op.Key])
+			continue
+		}
+
+		wg.Add(1)
+		go func(op OpConfig) {
+			defer wg.Done()
+			defer close(done[op.Key])
+
+			if plan.skipped[op.Name] {
+				mu.Lock()
+				response.Ops[op.Name] = &OpStatus{Status: StatusSkipped}
+				mu.Unlock()
+				return
+			}
+
+			for _, dep := range plan.deps[op.Name] {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			start := time.Now()
+			mu.Lock()
+			deps := buildDeps(registry, plan.deps[op.Name], response.Fields)
+			started[op.Name] = start
+			mu.Unlock()
+
+			var value interface{}
+			options := plan.options[op.Name]
+			resp, err := callOp(ctx, op, text, deps, options)
+			if err == nil {
+				value = resp.Value
+				if !checkType(op.Type, value) {
+					err = fmt.Errorf("expected %s value, got %T", op.Type, value)
+				}
+			}
+			status := &OpStatus{Status: StatusOK}
+			if err != nil && ctx.Err() == nil && shouldFallback(op, err) {
+				if fallbackValue, fallbackErr := runFallback(op, text, deps, options); fallbackErr == nil {
+					// Keep the remote error so callers can tell why.
+					status.Status = StatusFallback
+					status.Error = err.Error()
+					value, err = fallbackValue, nil
+				} else {
+					err = fmt.Errorf("%w; fallback: %v", err, fallbackErr)
+				}
+			}
+			status.LatencyMs = latencyMs(time.Since(start))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if finished || (err != nil && ctx.Err() != nil) {
+				// Reported as timed out below.
+				return
+			}
+			response.Ops[op.Name] = status
+			if err != nil {
+				status.Status = StatusFailed
+				status.Error = err.Error()
+				errors = append(errors, fmt.Errorf("%s: %w", op.Name, err))
+				return
+			}
+			if status.Status == StatusFallback {
+				// The value is usable, but the op itself is down.
+				errors = append(errors, fmt.Errorf("%s: served by fallback: %s", op.Name, status.Error))
+			}
+			response.Fields[op.Key] = value
+		}(op)
+	}
+
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+
+	select {
+	case <-allDone:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	finished = true
+
+	for _, op := range registry.Ops {
+		if plan.excluded[op.Name] {
+			continue
+		}
+		if plan.skipped[op.Name] {
+			response.Skipped = append(response.Skipped, op.Name)
+		}
+		if _, ok := response.Ops[op.Name]; ok {
+			continue
+		}
+		status := &OpStatus{Status: StatusTimeout, Error: ctx.Err().Error()}
+		if start, ok := started[op.Name]; ok {
+			status.LatencyMs = latencyMs(time.Since(start))
+		}
+		response.Ops[op.Name] = status
+		response.Partial = true
+		errors = append(errors, fmt.Errorf("%s: %w", op.Name, ctx.Err()))
+	}
+
+	if len(errors) > 0 {
+		response.Degraded = true
+		log.Printf("Some services failed: %v", errors)
+	}
+
+	return response, nil
+}
+
+func latencyMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Dependants of an op with a dep_field get the narrowed value, with the
+// op's dep_extras next to it.
+func TestBuildDepsExtras(t *testing.T) {
+	reg, err := newRegistry([]OpConfig{
+		{Name: "normalizer", URL: "http://normalizer", Key: "normalized", Type: TypeString},
+		{Name: "tokenizer", URL: "http://tokenizer", Key: "tokens", Type: TypeObject, Deps: []string{"normalized"},
+			DepField: "tokens", DepExtras: map[string]string{"tokens_truncated": "truncated"}},
+		{Name: "counter", URL: "http://counter", Key: "counts", Type: TypeObject, Deps: []string{"normalized", "tokens"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string]interface{}{
+		"normalized": "to be",
+		"tokens":     map[string]interface{}{"tokens": []interface{}{"to", "be"}, "count": 1001.0, "truncated": true},
+	}
+	want := map[string]interface{}{
+		"normalized":       "to be",
+		"tokens":           []interface{}{"to", "be"},
+		"tokens_truncated": true,
+	}
+	if deps := buildDeps(reg, []string{"normalized", "tokens"}, outputs); !reflect.DeepEqual(deps, want) {
+		t.Errorf("deps = %v, want %v", deps, want)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRegistry is used when OPS_CONFIG is not set.
+//
+//go:embed ops.json
+var defaultRegistry []byte
+
+// Value types an op may declare for its output.
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeObject = "object"
+	TypeArray  = "array"
+	// TypeInteger is only valid for options.
+	TypeInteger = "integer"
+)
+
+// OpConfig describes one op service in the registry.
+type OpConfig struct {
+	// Name identifies the op, e.g. "slugger".
+	Name string `json:"name"`
+	// URL is the base URL of the op service; "/op" is appended to it. A
+	// grpc://host:port URL calls the op's gRPC Run method instead. It can
+	// be overridden with the <NAME>_URL environment variable.
+	URL string `json:"url"`
+	// Key is the field the op's value is reported under in AnalyseResponse
+	// and the dep name it provides to other ops.
+	Key string `json:"key"`
+	// Type is the JSON type of the op's value.
+	Type string `json:"type"`
+	// Deps lists the keys of other ops whose values this op consumes
+	// through OpRequest.Deps.
+	Deps []string `json:"deps,omitempty"`
+	// DepField, for ops of type object, names the member of the value
+	// that ops depending on Key receive, e.g. "tokens" to pass on the
+	// token list of {"tokens": [...], "count": 2}. By default they receive
+	// the whole value.
+	DepField string `json:"dep_field,omitempty"`
+	// DepExtras, for ops with a DepField, passes other members of the
+	// value alongside it, keyed by the deps name they are sent under,
+	// e.g. {"tokens_truncated": "truncated"} to say whether the token list
+	// was cut.
+	DepExtras map[string]string `json:"dep_extras,omitempty"`
+	// Enabled is the op's initial kill switch state; ops are enabled unless
+	// it is false. <NAME>_ENABLED and the admin endpoint override it.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Timeout bounds each call to the op, e.g. "2s". It defaults to
+	// OP_TIMEOUT, or 10s when that is unset.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Retries is how many times a failed call is retried. It defaults to
+	// OP_RETRIES, or 2 when that is unset.
+	Retries *int `json:"retries,omitempty"`
+	// Hedge enables hedged requests for the op. It defaults to
+	// HEDGE_ENABLED.
+	Hedge *bool `json:"hedge,omitempty"`
+	// Fallback computes the op's value in-process when the remote call
+	// fails. Only ops with a built-in implementation support it.
+	// <NAME>_FALLBACK overrides it.
+	Fallback bool `json:"fallback,omitempty"`
+	// Version identifies the op's algorithm. It is part of the result
+	// cache key, so bumping it invalidates cached results.
+	Version string `json:"version,omitempty"`
+	// Options declares the per-request settings the op accepts in
+	// OpRequest.Options, keyed by name, e.g. "max_length".
+	Options map[string]OptionConfig `json:"options,omitempty"`
+	// SinceAPI is the first API version whose responses include the op's
+	// field by default, e.g. 2 for ops added after v1 was frozen. Older
+	// versions only run the op when a request asks for its field. It
+	// defaults to every version.
+	SinceAPI int `json:"since_api,omitempty"`
+}
+
+// OptionConfig declares one per-request setting of an op.
+type OptionConfig struct {
+	// Type is the option's JSON type: string, integer, number or bool.
+	Type string `json:"type"`
+	// Description documents the option, e.g. in the GraphQL schema.
+	Description string `json:"description,omitempty"`
+	// Deps maps values of a string option to the keys of other ops the op
+	// also consumes when a request sets the option to that value, e.g.
+	// {"auto": ["language"]}. Other requests neither wait for those ops
+	// nor run them on the op's behalf.
+	Deps map[string][]string `json:"deps,omitempty"`
+}
+
+// Duration is a time.Duration read from a string such as "1.5s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// optionName matches valid option names: lowercase words joined by
+// underscores.
+var optionName = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// reservedKeys are AnalyseResponse fields that ops cannot report under.
+var reservedKeys = map[string]bool{
+	"degraded":  true,
+	"skipped":   true,
+	"ops":       true,
+	"partial":   true,
+	"id":        true,
+	"error":     true,
+	"cache_hit": true,
+}
+
+// Registry is the validated set of ops the aggregator runs.
+type Registry struct {
+	// Ops are sorted so that every op comes after the ops it depends on.
+	Ops []OpConfig
+	// byKey maps an output key to the op producing it.
+	byKey  map[string]*OpConfig
+	byName map[string]*OpConfig
+}
+
+// loadRegistry reads the registry from the file named by OPS_CONFIG, or
+// falls back to the embedded default.
+func loadRegistry() (*Registry, error) {
+	data := defaultRegistry
+	if path := os.Getenv("OPS_CONFIG"); path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading ops config: %w", err)
+		}
+	}
+
+	var config struct {
+		Ops []OpConfig `json:"ops"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing ops config: %w", err)
+	}
+
+	defaultTimeout, err := time.ParseDuration(getEnv("OP_TIMEOUT", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("OP_TIMEOUT: %w", err)
+	}
+
+	defaultRetries, err := strconv.Atoi(getEnv("OP_RETRIES", "2"))
+	if err != nil || defaultRetries < 0 {
+		return nil, fmt.Errorf("OP_RETRIES: invalid value %q", getEnv("OP_RETRIES", "2"))
+	}
+
+	for i := range config.Ops {
+		op := &config.Ops[i]
+		op.URL = getEnv(envName(op.Name, "URL"), op.URL)
+		if op.Timeout.Duration <= 0 {
+			op.Timeout.Duration = defaultTimeout
+		}
+		if value := getEnv(envName(op.Name, "FALLBACK"), ""); value != "" {
+			fallback, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", envName(op.Name, "FALLBACK"), err)
+			}
+			op.Fallback = fallback
+		}
+		if op.Retries == nil {
+			retries := defaultRetries
+			op.Retries = &retries
+		}
+	}
+
+	return newRegistry(config.Ops)
+}
+
+// envName returns the per-op environment variable name, e.g.
+// envName("slugger", "URL") is "SLUGGER_URL".
+func envName(op, suffix string) string {
+	return strings.ToUpper(strings.ReplaceAll(op, "-", "_")) + "_" + suffix
+}
+
+// newRegistry validates ops and orders them by their dependencies.
+func newRegistry(ops []OpConfig) (*Registry, error) {
+	names := make(map[string]bool, len(ops))
+	byKey := make(map[string]*OpConfig, len(ops))
+	for i := range ops {
+		op := &ops[i]
+		if op.Name == "" {
+			return nil, fmt.Errorf("ops[%d]: name is required", i)
+		}
+		if names[op.Name] {
+			return nil, fmt.Errorf("op %q: duplicate name", op.Name)
+		}
+		names[op.Name] = true
+		if op.URL == "" {
+			return nil, fmt.Errorf("op %q: url is required", op.Name)
+		}
+		if u, err := url.Parse(op.URL); err != nil || u.Host == "" ||
+			(u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "grpc") {
+			return nil, fmt.Errorf("op %q: url %q must be an http, https or grpc URL", op.Name, op.URL)
+		}
+		if op.Key == "" {
+			return nil, fmt.Errorf("op %q: key is required", op.Name)
+		}
+		if reservedKeys[op.Key] {
+			return nil, fmt.Errorf("op %q: key %q is reserved", op.Name, op.Key)
+		}
+		if other, ok := byKey[op.Key]; ok {
+			return nil, fmt.Errorf("op %q: key %q already provided by %q", op.Name, op.Key, other.Name)
+		}
+		if op.Retries != nil && *op.Retries < 0 {
+			return nil, fmt.Errorf("op %q: retries must not be negative", op.Name)
+		}
+		switch op.Type {
+		case TypeString, TypeNumber, TypeBool, TypeObject, TypeArray:
+		default:
+			return nil, fmt.Errorf("op %q: unknown type %q", op.Name, op.Type)
+		}
+		if op.SinceAPI < 0 || op.SinceAPI > int(latestAPIVersion) {
+			return nil, fmt.Errorf("op %q: since_api must be between 1 and %d", op.Name, latestAPIVersion)
+		}
+		if op.DepField != "" && op.Type != TypeObject {
+			return nil, fmt.Errorf("op %q: dep_field needs type %q", op.Name, TypeObject)
+		}
+		if len(op.DepExtras) > 0 && op.DepField == "" {
+			return nil, fmt.Errorf("op %q: dep_extras needs dep_field", op.Name)
+		}
+		for name, option := range op.Options {
+			if !optionName.MatchString(name) {
+				return nil, fmt.Errorf("op %q: invalid option name %q", op.Name, name)
+			}
+			switch option.Type {
+			case TypeString, TypeInteger, TypeNumber, TypeBool:
+			default:
+				return nil, fmt.Errorf("op %q: option %q: unknown type %q", op.Name, name, option.Type)
+			}
+			if len(option.Deps) > 0 && option.Type != TypeString {
+				return nil, fmt.Errorf("op %q: option %q: deps needs type %q", op.Name, name, TypeString)
+			}
+		}
+		byKey[op.Key] = op
+	}
+
+	for _, op := range ops {
+		for name := range op.DepExtras {
+			if !optionName.MatchString(name) {
+				return nil, fmt.Errorf("op %q: invalid dep_extras name %q", op.Name, name)
+			}
+			if other, ok := byKey[name]; ok {
+				return nil, fmt.Errorf("op %q: dep_extras name %q is the key of %q", op.Name, name, other.Name)
+			}
+		}
+		for _, dep := range op.allDeps() {
+			if _, ok := byKey[dep]; !ok {
+				return nil, fmt.Errorf("op %q: no op provides dep %q", op.Name, dep)
+			}
+		}
+	}
+
+	sorted, err := sortOps(ops, byKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &Registry{
+		Ops:    sorted,
+		byKey:  make(map[string]*OpConfig, len(sorted)),
+		byName: make(map[string]*OpConfig, len(sorted)),
+	}
+	for i := range reg.Ops {
+		reg.byKey[reg.Ops[i].Key] = &reg.Ops[i]
+		reg.byName[reg.Ops[i].Name] = &reg.Ops[i]
+	}
+	return reg, nil
+}
+
+// sortOps orders ops topologically, keeping the config order where the
+// dependencies allow it, and rejects dependency cycles. Deps that options
+// may add count too, so an op comes after them whatever a request asks.
+func sortOps(ops []OpConfig, byKey map[string]*OpConfig) ([]OpConfig, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(ops))
+	sorted := make([]OpConfig, 0, len(ops))
+
+	var visit func(op *OpConfig) error
+	visit = func(op *OpConfig) error {
+		switch state[op.Name] {
+		case visiting:
+			return fmt.Errorf("op %q: dependency cycle", op.Name)
+		case visited:
+			return nil
+		}
+		state[op.Name] = visiting
+		for _, dep := range op.allDeps() {
+			if err := visit(byKey[dep]); err != nil {
+				return err
+			}
+		}
+		state[op.Name] = visited
+		sorted = append(sorted, *op)
+		return nil
+	}
+
+	for i := range ops {
+		if err := visit(&ops[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// allDeps returns the keys the op may consume: its Deps, and those any of
+// its options may add.
+func (op *OpConfig) allDeps() []string {
+	deps := op.Deps
+	for _, name := range op.optionNames() {
+		for _, value := range sortedKeys(op.Options[name].Deps) {
+			deps = appendMissing(deps, op.Options[name].Deps[value]...)
+		}
+	}
+	return deps
+}
+
+// depsFor returns the keys the op consumes for a request that sets
+// options: its Deps, and those the option values add.
+func (op *OpConfig) depsFor(options map[string]interface{}) []string {
+	deps := op.Deps
+	for _, name := range op.optionNames() {
+		if value, ok := options[name].(string); ok {
+			deps = appendMissing(deps, op.Options[name].Deps[value]...)
+		}
+	}
+	return deps
+}
+
+// optionNames returns the names of the op's options in order.
+func (op *OpConfig) optionNames() []string {
+	return sortedKeys(op.Options)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendMissing appends the keys that list lacks, copying list first so
+// that it is never modified.
+func appendMissing(list []string, keys ...string) []string {
+	for _, key := range keys {
+		if !slices.Contains(list, key) {
+			list = append(slices.Clip(list), key)
+		}
+	}
+	return list
+}
+
+// Op returns the op with the given name.
+func (reg *Registry) Op(name string) (*OpConfig, bool) {
+	op, ok := reg.byName[name]
+	return op, ok
+}
+
+// Needed returns the names of the ops producing keys, together with
+// every op they depend on, directly or not, given the per-request options
+// keyed by op name.
+func (reg *Registry) Needed(keys []string, options map[string]map[string]interface{}) map[string]bool {
+	needed := make(map[string]bool)
+	var visit func(key string)
+	visit = func(key string) {
+		op := reg.byKey[key]
+		if op == nil || needed[op.Name] {
+			return
+		}
+		needed[op.Name] = true
+		for _, dep := range op.depsFor(options[op.Name]) {
+			visit(dep)
+		}
+	}
+	for _, key := range keys {
+		visit(key)
+	}
+	return needed
+}
+
+// checkType reports whether value, as decoded by encoding/json, matches
+// the declared type.
+func checkType(typ string, value interface{}) bool {
+	switch typ {
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeNumber:
+		_, ok := value.(float64)
+		return ok
+	case TypeBool:
+		_, ok := value.(bool)
+		return ok
+	case TypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case TypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+// checkOptionType is checkType for option values, which may also be
+// integers.
+func checkOptionType(typ string, value interface{}) bool {
+	if typ == TypeInteger {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return checkType(typ, value)
+}
+
+// checkOpOptions checks per-request options, keyed by op name, against
+// the options the ops declare.
+func (reg *Registry) checkOpOptions(options map[string]map[string]interface{}) error {
+	for name, values := range options {
+		op, ok := reg.Op(name)
+		if !ok {
+			return fmt.Errorf("options: unknown op %q", name)
+		}
+		for key, value := range values {
+			option, ok := op.Options[key]
+			if !ok {
+				return fmt.Errorf("options: op %q has no option %q", name, key)
+			}
+			if !checkOptionType(option.Type, value) {
+				return fmt.Errorf("options: %s.%s must be of type %s", name, key, option.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// zeroValue is reported for ops that produced no value.
+func zeroValue(typ string) interface{} {
+	switch typ {
+	case TypeString:
+		return ""
+	case TypeNumber:
+		return 0
+	case TypeBool:
+		return false
+	case TypeObject:
+		return map[string]interface{}{}
+	case TypeArray:
+		return []interface{}{}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// An option value that declares deps pulls in the ops providing them, and
+// only for requests that set it.
+func TestPlanOptionDeps(t *testing.T) {
+	reg, err := newRegistry([]OpConfig{
+		{Name: "transliterator", URL: "http://transliterator", Key: "transliterated", Type: TypeString, Options: map[string]OptionConfig{
+			"standard": {Type: TypeString, Deps: map[string][]string{"auto": {"language"}}},
+		}},
+		{Name: "langid", URL: "http://langid", Key: "language", Type: TypeObject, DepField: "language"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Ops[0].Name != "langid" {
+		t.Errorf("order = %s, %s; want langid first", reg.Ops[0].Name, reg.Ops[1].Name)
+	}
+	s, err := newOpSwitches(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		standard string
+		wantDeps []string
+	}{
+		{"", nil},
+		{"basic", nil},
+		{"auto", []string{"language"}},
+	} {
+		opts := AnalyseOptions{Fields: []string{"transliterated"}}
+		if test.standard != "" {
+			opts.OpOptions = map[string]map[string]interface{}{"transliterator": {"standard": test.standard}}
+		}
+		plan := s.Plan(reg, opts)
+		if deps := plan.deps["transliterator"]; !slices.Equal(deps, test.wantDeps) {
+			t.Errorf("standard %q: deps = %v, want %v", test.standard, deps, test.wantDeps)
+		}
+		if excluded := plan.excluded["langid"]; excluded != (test.wantDeps == nil) {
+			t.Errorf("standard %q: langid excluded = %v", test.standard, excluded)
+		}
+	}
+}
+
+func TestNewRegistryOptionDeps(t *testing.T) {
+	for _, test := range []struct {
+		option OptionConfig
+		want   string
+	}{
+		{OptionConfig{Type: TypeInteger, Deps: map[string][]string{"1": {"normalized"}}}, "deps needs type"},
+		{OptionConfig{Type: TypeString, Deps: map[string][]string{"auto": {"language"}}}, `no op provides dep "language"`},
+		{OptionConfig{Type: TypeString, Deps: map[string][]string{"auto": {"slug"}}}, "dependency cycle"},
+	} {
+		_, err := newRegistry([]OpConfig{
+			{Name: "normalizer", URL: "http://normalizer", Key: "normalized", Type: TypeString},
+			{Name: "transliterator", URL: "http://transliterator", Key: "transliterated", Type: TypeString,
+				Options: map[string]OptionConfig{"standard": test.option}},
+			{Name: "slugger", URL: "http://slugger", Key: "slug", Type: TypeString, Deps: []string{"transliterated"}},
+		})
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%+v: got error %v, want %q", test.option, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+var (
+	// streamWindow bounds how many stream items can be read ahead of the
+	// result being written back. Once it is full the aggregator stops
+	// reading the request body, pushing back on the client.
+	streamWindow  = max(mustParseInt("STREAM_WINDOW", "64"), 1)
+	streamMaxLine = max(mustParseInt("STREAM_MAX_LINE_BYTES", "1048576"), 1)
+)
+
+var errLineTooLong = errors.New("line too long")
+
+// handleAnalyzeStream reads NDJSON items ({"id": "...", "text": "..."}) from
+// the request body and writes one /analyze response per item back as
+// NDJSON, in input order, while the body is still being read. A malformed
+// line produces an error record instead of ending the stream; a body that
+// cannot be read ends it with one. Items are analysed on the batch worker
+// pool, and X-Request-Timeout applies to each item.
+func handleAnalyzeStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := parseAnalyseOptions(r, registry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Stream results keep the v1 shape.
+	pinFields(registry, apiV1, &opts)
+
+	budget, err := requestBudget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Without full duplex, HTTP/1 handlers cannot write the response while
+	// the request body is still being read. HTTP/2 does not need it.
+	if err := rc.EnableFullDuplex(); err != nil && r.ProtoMajor == 1 {
+		log.Printf("Stream: full duplex unavailable: %v", err)
+	}
+
+	// Touch the body before answering so that a client waiting on
+	// "Expect: 100-continue" gets to send it.
+	reader := bufio.NewReaderSize(r.Body, 64*1024)
+	_, peekErr := reader.Peek(1)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if peekErr != nil && peekErr != io.EOF {
+		log.Printf("Stream: reading request body: %v", peekErr)
+		json.NewEncoder(w).Encode(itemError("", fmt.Sprintf("reading request body: %v", peekErr)))
+		return
+	}
+
+	ctx := r.Context()
+	pending := make(chan chan *AnalyseResponse, streamWindow)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		enc := json.NewEncoder(w)
+		failed := false
+		for result := range pending {
+			response := <-result
+			if failed {
+				continue
+			}
+			if err := enc.Encode(response); err != nil {
+				failed = true
+				continue
+			}
+			rc.Flush()
+		}
+	}()
+
+readLoop:
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := readLine(reader, streamMaxLine)
+		if readErr != nil && readErr != io.EOF && readErr != errLineTooLong {
+			if ctx.Err() == nil {
+				log.Printf("Stream: reading request body: %v", readErr)
+				result := make(chan *AnalyseResponse, 1)
+				result <- itemError("", fmt.Sprintf("line %d: reading request body: %v", lineNo, readErr))
+				select {
+				case pending <- result:
+				case <-ctx.Done():
+				}
+			}
+			break
+		}
+		if readErr == io.EOF && len(line) == 0 {
+			break
+		}
+		if readErr != errLineTooLong && len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		result := make(chan *AnalyseResponse, 1)
+		select {
+		case pending <- result:
+		case <-ctx.Done():
+			break readLoop
+		}
+
+		if readErr == errLineTooLong {
+			result <- itemError("", fmt.Sprintf("line %d: %v (max %d bytes)", lineNo, readErr, streamMaxLine))
+			continue
+		}
+		var item AnalyseItem
+		if err := decodeJSON(line, "AnalyseItem", &item); err != nil {
+			result <- itemError(item.ID, fmt.Sprintf("line %d: %v", lineNo, err))
+			if readErr == io.EOF {
+				break
+			}
+			continue
+		}
+
+		select {
+		case batchSlots <- struct{}{}:
+		case <-ctx.Done():
+			result <- itemError(item.ID, ctx.Err().Error())
+			break readLoop
+		}
+		streamItems.Inc()
+		go func(item AnalyseItem) {
+			defer func() { <-batchSlots }()
+			var itemCtx context.Context
+			var cancel context.CancelFunc
+			if budget > 0 {
+				itemCtx, cancel = context.WithTimeout(ctx, budget)
+			} else {
+				itemCtx, cancel = context.WithCancel(ctx)
+			}
+			defer cancel()
+			result <- analyseItem(itemCtx, item, opts)
+		}(item)
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	close(pending)
+	<-writerDone
+}
+
+// readLine returns the next line of r without its line ending. A line
+// longer than limit is consumed entirely and reported as errLineTooLong.
+// The last line may come with io.EOF.
+func readLine(r *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) > limit+2 {
+			tooLong = true
+			line = nil
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong {
+			return nil, errLineTooLong
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > limit {
+			return nil, errLineTooLong
+		}
+		return line, err
+	}
+}
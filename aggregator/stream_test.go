@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// useTestOpenAPI builds the request schemas for the test registry.
+func useTestOpenAPI(t *testing.T) {
+	t.Helper()
+	saved := openapiDoc
+	t.Cleanup(func() { openapiDoc = saved })
+	var err error
+	if openapiDoc, err = newOpenAPIDoc(registry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stream posts body to /analyze/stream and decodes the records written
+// back.
+func stream(t *testing.T, body io.Reader) []AnalyseResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleAnalyzeStream(rec, httptest.NewRequest("POST", "/analyze/stream", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var records []AnalyseResponse
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var record AnalyseResponse
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestStreamErrorRecords(t *testing.T) {
+	upperOp(t, 0)
+	useTestOpenAPI(t)
+	saved := streamMaxLine
+	t.Cleanup(func() { streamMaxLine = saved })
+	streamMaxLine = 64
+
+	body := strings.Join([]string{
+		`{"id": "a", "text": "stream a"}`,
+		`{"id": "b", "text"`,
+		``,
+		`{"id": "long", "text": "` + strings.Repeat("x", 64) + `"}`,
+		`{"id": "c", "text": 1}`,
+		`{"id": "d", "text": "stream d"}`,
+	}, "\r\n")
+	records := stream(t, strings.NewReader(body))
+
+	want := []struct{ id, err string }{
+		{"a", ""},
+		{"", "line 2: Invalid JSON"},
+		{"", "line 4: line too long (max 64 bytes)"},
+		{"", "line 5: Invalid request"},
+		{"d", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		record := records[i]
+		if w.err == "" {
+			if record.ID != w.id || record.Error != "" {
+				t.Errorf("record %d = %+v, want %s analysed", i, record, w.id)
+			}
+			continue
+		}
+		if !strings.HasPrefix(record.Error, w.err) || !record.Degraded {
+			t.Errorf("record %d error = %q, want %q...", i, record.Error, w.err)
+		}
+	}
+}
+
+func TestStreamBodyReadErrors(t *testing.T) {
+	upperOp(t, 0)
+	useTestOpenAPI(t)
+	boom := errors.New("boom")
+
+	records := stream(t, iotest.ErrReader(boom))
+	if len(records) != 1 || records[0].Error != "reading request body: boom" {
+		t.Errorf("unreadable body: records = %+v", records)
+	}
+
+	body := io.MultiReader(strings.NewReader(`{"id": "a", "text": "stream read a"}`+"\n"), iotest.ErrReader(boom))
+	records = stream(t, body)
+	if len(records) != 2 || records[0].ID != "a" || records[0].Error != "" || records[1].Error != "line 2: reading request body: boom" {
+		t.Errorf("body failing mid-stream: records = %+v", records)
+	}
+
+	if records := stream(t, strings.NewReader("")); len(records) != 0 {
+		t.Errorf("empty body: records = %+v", records)
+	}
+}
+
+// With every item stuck, the stream stops reading the body once the
+// window is full.
+func TestStreamWindowBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(OpResponse{Key: "normalized", Value: strings.ToUpper(*req.Text)})
+	}))
+	t.Cleanup(srv.Close)
+	useTestRegistry(t, OpConfig{Name: "normalizer", URL: srv.URL, Key: "normalized", Type: TypeString})
+	useTestOpenAPI(t)
+	saved := streamWindow
+	t.Cleanup(func() { streamWindow = saved })
+	streamWindow = 2
+
+	const items = 20
+	pr, pw := io.Pipe()
+	var written atomic.Int32
+	go func() {
+		for i := 0; i < items; i++ {
+			fmt.Fprintf(pw, `{"id": "%d", "text": "backpressure %d"}`+"\n", i, i)
+			written.Add(1)
+		}
+		pw.Close()
+	}()
+	done := make(chan []AnalyseResponse)
+	go func() { done <- stream(t, pr) }()
+
+	// One item waits in the writer, streamWindow in the window, and the
+	// next line has been read and waits for room.
+	time.Sleep(100 * time.Millisecond)
+	if n := written.Load(); n > int32(streamWindow)+2 {
+		t.Errorf("%d lines read with a window of %d", n, streamWindow)
+	}
+
+	close(release)
+	select {
+	case records := <-done:
+		if len(records) != items {
+			t.Fatalf("got %d records, want %d", len(records), items)
+		}
+		for i, record := range records {
+			if record.ID != fmt.Sprint(i) || record.Error != "" {
+				t.Errorf("record %d = %+v", i, record)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not finish")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// opSwitches holds the runtime kill switch of every registered op.
+type opSwitches struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+}
+
+var switches *opSwitches
+
+// newOpSwitches seeds the switches from the registry's "enabled" fields,
+// then from the <NAME>_ENABLED environment variables.
+func newOpSwitches(reg *Registry) (*opSwitches, error) {
+	s := &opSwitches{enabled: make(map[string]bool, len(reg.Ops))}
+	for _, op := range reg.Ops {
+		enabled := op.Enabled == nil || *op.Enabled
+		if value := getEnv(envName(op.Name, "ENABLED"), ""); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", envName(op.Name, "ENABLED"), err)
+			}
+			enabled = parsed
+		}
+		s.enabled[op.Name] = enabled
+	}
+	return s, nil
+}
+
+func (s *opSwitches) Enabled(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled[name]
+}
+
+func (s *opSwitches) Set(name string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.enabled[name]; !ok {
+		return fmt.Errorf("unknown op %q", name)
+	}
+	s.enabled[name] = enabled
+	return nil
+}
+
+// AnalyseOptions are the per-request overrides of /analyze.
+type AnalyseOptions struct {
+	// Disable lists ops to skip for this request.
+	Disable []string
+	// Only, when non-empty, restricts the request to the listed ops.
+	Only []string
+	// Fields, when non-empty, restricts the response to the listed keys
+	// and the request to the ops needed to produce them.
+	Fields []string
+	// OpOptions holds per-request op settings keyed by op name; they are
+	// passed on in OpRequest.Options.
+	OpOptions map[string]map[string]interface{}
+}
+
+// parseAnalyseOptions reads the disable=, only= and fields= query
+// parameters. They accept repeated parameters and comma-separated values.
+func parseAnalyseOptions(r *http.Request, reg *Registry) (AnalyseOptions, error) {
+	var opts AnalyseOptions
+	query := r.URL.Query()
+	fields, err := parseFields(reg, query["fields"])
+	if err != nil {
+		return opts, err
+	}
+	opts.Fields = fields
+	if opts.Disable, err = parseOpNames(reg, "disable", query["disable"]); err != nil {
+		return opts, err
+	}
+	if opts.Only, err = parseOpNames(reg, "only", query["only"]); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// parseOpNames splits comma-separated op names and checks they are
+// registered. param names the option in errors.
+func parseOpNames(reg *Registry, param string, values []string) ([]string, error) {
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := reg.Op(name); !ok {
+				return nil, fmt.Errorf("%s: unknown op %q", param, name)
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// analysisPlan says which ops a request leaves out.
+type analysisPlan struct {
+	// skipped ops are switched off; they are reported as skipped.
+	skipped map[string]bool
+	// excluded ops are not needed for the requested fields; they are not
+	// reported at all.
+	excluded map[string]bool
+	// options are the settings passed to the ops that run.
+	options map[string]map[string]interface{}
+	// deps are the keys every op that runs consumes, given its options.
+	deps map[string][]string
+}
+
+// Plan works out which ops must not be called for a request. Request
+// options can only narrow the set of enabled ops: an op switched off
+// globally stays off whatever the request asks for.
+func (s *opSwitches) Plan(reg *Registry, opts AnalyseOptions) analysisPlan {
+	only := make(map[string]bool, len(opts.Only))
+	for _, name := range opts.Only {
+		only[name] = true
+	}
+	disable := make(map[string]bool, len(opts.Disable))
+	for _, name := range opts.Disable {
+		disable[name] = true
+	}
+
+	var needed map[string]bool
+	if len(opts.Fields) > 0 {
+		needed = reg.Needed(opts.Fields, opts.OpOptions)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	plan := analysisPlan{
+		skipped:  make(map[string]bool),
+		excluded: make(map[string]bool),
+		options:  make(map[string]map[string]interface{}),
+		deps:     make(map[string][]string),
+	}
+	for _, op := range reg.Ops {
+		switch {
+		case needed != nil && !needed[op.Name]:
+			plan.excluded[op.Name] = true
+		case !s.enabled[op.Name] || disable[op.Name] || (len(only) > 0 && !only[op.Name]):
+			plan.skipped[op.Name] = true
+		default:
+			if len(opts.OpOptions[op.Name]) > 0 {
+				plan.options[op.Name] = opts.OpOptions[op.Name]
+			}
+			plan.deps[op.Name] = op.depsFor(opts.OpOptions[op.Name])
+		}
+	}
+	return plan
+}
+
+type opSwitchState struct {
+	Name    string `json:"name"`
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+}
+
+// handleAdminOps lists the kill switches on GET and flips one on POST with
+// a body of {"name": "slugger", "enabled": false}.
+func handleAdminOps(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var req struct {
+			Name    string `json:"name"`
+			Enabled *bool  `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Enabled == nil {
+			http.Error(w, "Enabled field is required", http.StatusBadRequest)
+			return
+		}
+		if err := switches.Set(req.Name, *req.Enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Op %s enabled=%t via admin endpoint", req.Name, *req.Enabled)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	states := make([]opSwitchState, 0, len(registry.Ops))
+	for _, op := range registry.Ops {
+		states = append(states, opSwitchState{Name: op.Name, Key: op.Key, Enabled: switches.Enabled(op.Name)})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
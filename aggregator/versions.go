@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is a version of the public /analyze contract.
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	apiV2 apiVersion = 2
+)
+
+// latestAPIVersion is the version successor-version links point to.
+const latestAPIVersion = apiV2
+
+func (v apiVersion) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+// mediaType is the vendor media type that selects v through Accept.
+func (v apiVersion) mediaType() string {
+	return fmt.Sprintf("application/vnd.aggregator.%s+json", v)
+}
+
+var (
+	// v1Deprecation and v1Sunset date the retirement of v1 in the
+	// Deprecation and Sunset headers of v1 responses. They are RFC 3339
+	// timestamps; either may be left unset.
+	v1Deprecation = mustParseTime("API_V1_DEPRECATION")
+	v1Sunset      = mustParseTime("API_V1_SUNSET")
+)
+
+func mustParseTime(key string) time.Time {
+	value := getEnv(key, "")
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return t
+}
+
+// negotiateVersion picks the version an unversioned request asks for in
+// its Accept header, e.g. "application/vnd.aggregator.v2+json". The
+// highest quality wins, then the newest version. Requests that name no
+// version get v1, today's contract. negotiated reports whether Accept
+// chose the version.
+func negotiateVersion(r *http.Request) (version apiVersion, negotiated bool) {
+	version = apiV1
+	bestQ := 0.0
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, _ := strings.Cut(mediaRange, ";")
+			var v apiVersion
+			switch strings.ToLower(strings.TrimSpace(mediaType)) {
+			case apiV1.mediaType():
+				v = apiV1
+			case apiV2.mediaType():
+				v = apiV2
+			default:
+				continue
+			}
+			q := acceptQuality(params)
+			if q > bestQ || (q == bestQ && q > 0 && v > version) {
+				version, bestQ, negotiated = v, q, true
+			}
+		}
+	}
+	return version, negotiated
+}
+
+// acceptQuality reads the q parameter of a media range, 1 by default.
+func acceptQuality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(name, "q") {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0
+			}
+			return q
+		}
+	}
+	return 1
+}
+
+// setVersionHeaders marks the response with its version. v1 responses
+// are also marked deprecated (RFC 9745), with the date when one is
+// configured, point at their successor and, when configured, say when v1
+// goes away (RFC 8594).
+func setVersionHeaders(w http.ResponseWriter, version apiVersion) {
+	h := w.Header()
+	h.Set("API-Version", version.String())
+	if version != apiV1 {
+		return
+	}
+	h.Add("Link", fmt.Sprintf("</%s/analyze>; rel=\"successor-version\"", latestAPIVersion))
+	if v1Deprecation.IsZero() {
+		h.Set("Deprecation", "true")
+	} else {
+		h.Set("Deprecation", fmt.Sprintf("@%d", v1Deprecation.Unix()))
+	}
+	if !v1Sunset.IsZero() {
+		h.Set("Sunset", v1Sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+// pinFields keeps the responses of version to the fields it was released
+// with: a request that names no fields gets those of the ops available
+// since that version, and ops added later are not run. Their outages then
+// neither mark the response degraded nor keep it out of the cache. They
+// can still be asked for with fields.
+func pinFields(reg *Registry, version apiVersion, opts *AnalyseOptions) {
+	if len(opts.Fields) > 0 {
+		return
+	}
+	var fields []string
+	pinned := false
+	for _, op := range reg.Ops {
+		if op.SinceAPI > int(version) {
+			pinned = true
+			continue
+		}
+		fields = append(fields, op.Key)
+	}
+	if pinned {
+		opts.Fields = fields
+	}
+}
+
+// AnalyseResponseV2 is the /v2/analyze response. Unlike v1 it reports each
+// op as an entry of its own, with a null value when the op produced
+// nothing.
+type AnalyseResponseV2 struct {
+	Ops      []OpResultV2   `json:"ops"`
+	Degraded bool           `json:"degraded"`
+	Partial  bool           `json:"partial"`
+	CacheHit bool           `json:"cache_hit"`
+	Meta     ResponseMetaV2 `json:"meta"`
+}
+
+// OpResultV2 is the outcome of one op in AnalyseResponseV2.
+type OpResultV2 struct {
+	Name      string      `json:"name"`
+	Key       string      `json:"key"`
+	Type      string      `json:"type"`
+	Version   string      `json:"version,omitempty"`
+	Status    string      `json:"status"`
+	Value     interface{} `json:"value"`
+	Error     string      `json:"error,omitempty"`
+	LatencyMs float64     `json:"latency_ms"`
+}
+
+type ResponseMetaV2 struct {
+	APIVersion string  `json:"api_version"`
+	DurationMs float64 `json:"duration_ms"`
+	// Fields echoes the fields the request asked for, if any.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// newAnalyseResponseV2 lists, in registry order, every op the analysis
+// reported: the ops it ran, including those only needed as deps of the
+// requested fields, and the ops that were skipped.
+func newAnalyseResponseV2(a *AnalyseResponse, fields []string, elapsed time.Duration) *AnalyseResponseV2 {
+	response := &AnalyseResponseV2{
+		Ops:      make([]OpResultV2, 0, len(a.Ops)),
+		Degraded: a.Degraded,
+		Partial:  a.Partial,
+		CacheHit: a.CacheHit,
+		Meta: ResponseMetaV2{
+			APIVersion: apiV2.String(),
+			DurationMs: latencyMs(elapsed),
+			Fields:     fields,
+		},
+	}
+	for _, op := range a.registry.Ops {
+		status, ok := a.Ops[op.Name]
+		if !ok {
+			continue
+		}
+		response.Ops = append(response.Ops, OpResultV2{
+			Name:      op.Name,
+			Key:       op.Key,
+			Type:      op.Type,
+			Version:   op.Version,
+			Status:    status.Status,
+			Value:     a.Fields[op.Key],
+			Error:     status.Error,
+			LatencyMs: status.LatencyMs,
+		})
+	}
+	return response
+}
+
+// handleAnalyzeVersion serves /analyze under a versioned path, which
+// fixes the version whatever Accept says.
+func handleAnalyzeVersion(version apiVersion) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveAnalyze(w, r, version, false)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// v1 responses say they are deprecated and name their successor even when
+// no dates are configured; Sunset needs its date.
+func TestSetVersionHeaders(t *testing.T) {
+	savedDeprecation, savedSunset := v1Deprecation, v1Sunset
+	t.Cleanup(func() { v1Deprecation, v1Sunset = savedDeprecation, savedSunset })
+
+	for _, test := range []struct {
+		version                               apiVersion
+		deprecation, sunset                   time.Time
+		wantDeprecation, wantSunset, wantLink string
+	}{
+		{apiV1, time.Time{}, time.Time{}, "true", "", `</v2/analyze>; rel="successor-version"`},
+		{apiV1, time.Unix(1760572800, 0), time.Unix(1776297600, 0), "@1760572800", "Thu, 16 Apr 2026 00:00:00 GMT", `</v2/analyze>; rel="successor-version"`},
+		{apiV2, time.Unix(1760572800, 0), time.Unix(1776297600, 0), "", "", ""},
+	} {
+		v1Deprecation, v1Sunset = test.deprecation, test.sunset
+		w := httptest.NewRecorder()
+		setVersionHeaders(w, test.version)
+		h := w.Header()
+		if h.Get("API-Version") != test.version.String() ||
+			h.Get("Deprecation") != test.wantDeprecation ||
+			h.Get("Sunset") != test.wantSunset ||
+			h.Get("Link") != test.wantLink {
+			t.Errorf("%s, deprecation %v, sunset %v: got headers %v", test.version, test.deprecation, test.sunset, h)
+		}
+	}
+}
+
+// v1 responses keep the fields v1 shipped with: an op added for v2 is not
+// run, so its outage cannot degrade them, unless its field is asked for.
+func TestPinFieldsKeepsV1Body(t *testing.T) {
+	var calls atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+	useTestRegistry(t,
+		OpConfig{Name: "normalizer", URL: slowOp(t, "normalized", "hello", 0), Key: "normalized", Type: TypeString},
+		OpConfig{Name: "hasher", URL: down.URL, Key: "hash", Type: TypeString, Deps: []string{"normalized"}, SinceAPI: 2},
+	)
+	text := "pin " + t.Name()
+
+	var opts AnalyseOptions
+	pinFields(registry, apiV1, &opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := analyse(ctx, text, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Degraded || calls.Load() != 0 {
+		t.Errorf("v1: degraded = %v after %d hasher calls, want no call", response.Degraded, calls.Load())
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	json.Unmarshal(data, &body)
+	if _, ok := body["hash"]; ok {
+		t.Errorf("v1 body has hash: %s", data)
+	}
+	if body["normalized"] != "hello" {
+		t.Errorf("v1 body: normalized = %v, want hello", body["normalized"])
+	}
+
+	opts = AnalyseOptions{Fields: []string{"hash"}}
+	pinFields(registry, apiV1, &opts)
+	if response, err = analyse(ctx, text, opts); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() == 0 || response.Ops["hasher"].Status != StatusFailed {
+		t.Errorf("v1 with fields=hash: hasher = %+v, want it called", response.Ops["hasher"])
+	}
+
+	opts = AnalyseOptions{}
+	pinFields(registry, apiV2, &opts)
+	if len(opts.Fields) != 0 {
+		t.Errorf("v2: fields = %v, want every field", opts.Fields)
+	}
+}
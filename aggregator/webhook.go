@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// webhookSecret signs callback deliveries. Jobs cannot carry a
+	// callback_url when it is empty.
+	webhookSecret     = getEnv("WEBHOOK_SECRET", "")
+	webhookTimeout    = mustParseDuration("WEBHOOK_TIMEOUT", "10s")
+	webhookRetries    = mustParseInt("WEBHOOK_RETRIES", "5")
+	webhookBackoff    = mustParseDuration("WEBHOOK_BACKOFF", "1s")
+	webhookMaxBackoff = mustParseDuration("WEBHOOK_MAX_BACKOFF", "5m")
+	deadLettersMax    = mustParseInt("WEBHOOK_DEAD_LETTERS_MAX", "1000")
+	// webhookAllowedNetworks are non-public networks callbacks may reach
+	// all the same, e.g. a receiver inside the cluster.
+	webhookAllowedNetworks = mustParsePrefixes("WEBHOOK_ALLOWED_NETWORKS")
+)
+
+func mustParsePrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			log.Fatalf("%s: %v", key, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// nonPublicNetworks are ranges that netip does not flag as private but
+// that are not reachable on the internet either.
+var nonPublicNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// errCallbackAddress is returned for callbacks to addresses they may not
+// reach.
+var errCallbackAddress = errors.New("callback address is not public")
+
+// callbackAddressAllowed reports whether a callback may connect to addr:
+// public unicast addresses, and any in WEBHOOK_ALLOWED_NETWORKS.
+func callbackAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range webhookAllowedNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkCallbackDial runs before every connection of webhookClient, on the
+// address the host name resolved to, so that neither DNS nor a redirect
+// can point a callback at the cluster, the node or a metadata endpoint.
+func checkCallbackDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !callbackAddressAllowed(addr) {
+		return fmt.Errorf("%w: %s", errCallbackAddress, addr)
+	}
+	return nil
+}
+
+// webhookClient delivers callbacks. Unlike httpClient it only connects
+// to public addresses, and it ignores proxy settings so the check sees
+// the receiver's address.
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   checkCallbackDial,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// checkCallbackURL accepts absolute http and https URLs. A host given as
+// an IP address must be one callbacks may reach; host names are checked
+// when the delivery connects.
+func checkCallbackURL(raw string) error {
+	if webhookSecret == "" {
+		return fmt.Errorf("callbacks are disabled")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid callback_url %q", raw)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !callbackAddressAllowed(addr) {
+		return fmt.Errorf("invalid callback_url %q: %w", raw, errCallbackAddress)
+	}
+	return nil
+}
+
+// signPayload returns the X-Aggregator-Signature of a delivery: the
+// hex HMAC-SHA256, keyed with WEBHOOK_SECRET, of "<timestamp>.<body>".
+func signPayload(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook makes one delivery attempt. Any 2xx answer counts as
+// delivered.
+func deliverWebhook(ctx context.Context, callbackURL, deliveryID string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Aggregator-Delivery", deliveryID)
+	req.Header.Set("X-Aggregator-Timestamp", timestamp)
+	req.Header.Set("X-Aggregator-Signature", signPayload(timestamp, payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{Code: resp.StatusCode}
+	}
+	return nil
+}
+
+// DeadLetter is a callback delivery that failed for good.
+type DeadLetter struct {
+	DeliveryID string    `json:"delivery_id"`
+	JobID      string    `json:"job_id"`
+	URL        string    `json:"url"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failed_at"`
+	// Payload is kept so the delivery can be replayed after the job
+	// itself has expired.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// deadLetterStore keeps failed deliveries, oldest first, in a single
+// file. Past WEBHOOK_DEAD_LETTERS_MAX the oldest are dropped.
+type deadLetterStore struct {
+	path string
+
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func openDeadLetterStore(dir string) (*deadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &deadLetterStore{path: filepath.Join(dir, "dead-letters.json")}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.letters); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+func (s *deadLetterStore) Add(letter DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, letter)
+	if over := len(s.letters) - deadLettersMax; over > 0 {
+		s.letters = append([]DeadLetter(nil), s.letters[over:]...)
+	}
+	s.saveLocked()
+}
+
+// List returns the dead letters without their payloads.
+func (s *deadLetterStore) List() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letters := make([]DeadLetter, len(s.letters))
+	for i, letter := range s.letters {
+		letter.Payload = nil
+		letters[i] = letter
+	}
+	return letters
+}
+
+func (s *deadLetterStore) Get(deliveryID string) (DeadLetter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, letter := range s.letters {
+		if letter.DeliveryID == deliveryID {
+			return letter, true
+		}
+	}
+	return DeadLetter{}, false
+}
+
+// Resolve records the outcome of a replay: the letter is removed when err
+// is nil and updated otherwise.
+func (s *deadLetterStore) Resolve(deliveryID string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.letters {
+		if s.letters[i].DeliveryID != deliveryID {
+			continue
+		}
+		if err == nil {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+		} else {
+			s.letters[i].Attempts++
+			s.letters[i].Error = err.Error()
+			s.letters[i].FailedAt = time.Now().UTC()
+		}
+		s.saveLocked()
+		return
+	}
+}
+
+func (s *deadLetterStore) saveLocked() {
+	data, err := json.Marshal(s.letters)
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Webhooks: saving dead letters: %v", err)
+	}
+}
+
+// notify delivers a finished job to its callback URL, retrying with
+// backoff, and moves the delivery to the dead-letter list when every
+// attempt has failed. Client errors other than 429 are not retried. If
+// ctx ends first the job is left unnotified, to be delivered again when
+// the store is next opened.
+func (s *jobStore) notify(ctx context.Context, j *job) {
+	j.mu.Lock()
+	if j.rec.CallbackURL == "" || j.rec.Notified {
+		j.mu.Unlock()
+		return
+	}
+	callbackURL, deliveryID, jobID := j.rec.CallbackURL, j.rec.DeliveryID, j.rec.ID
+	j.mu.Unlock()
+
+	payload, err := json.Marshal(j.Status(true))
+	if err != nil {
+		log.Printf("Webhooks: encoding job %s: %v", jobID, err)
+		return
+	}
+
+	attempts := 0
+	for {
+		attempts++
+		err = deliverWebhook(ctx, callbackURL, deliveryID, payload)
+		if err == nil {
+			webhookDeliveries.Inc("delivered")
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		webhookDeliveries.Inc("failed")
+		log.Printf("Webhooks: delivery %s for job %s, attempt %d: %v", deliveryID, jobID, attempts, err)
+		if attempts > webhookRetries || !retryable(err) {
+			webhookDeliveries.Inc("dead_letter")
+			s.deadLetters.Add(DeadLetter{
+				DeliveryID: deliveryID,
+				JobID:      jobID,
+				URL:        callbackURL,
+				Attempts:   attempts,
+				Error:      err.Error(),
+				FailedAt:   time.Now().UTC(),
+				Payload:    payload,
+			})
+			break
+		}
+		if !sleepContext(ctx, backoff(attempts, webhookBackoff, webhookMaxBackoff)) {
+			return
+		}
+	}
+
+	j.mu.Lock()
+	j.rec.Notified = true
+	j.dirty = true
+	j.mu.Unlock()
+	s.saveLogged(j)
+}
+
+// handleAdminDeadLetters lists failed callback deliveries on GET
+// /admin/webhooks/dead-letters and replays one on POST
+// /admin/webhooks/dead-letters/{delivery_id}/replay. A replay makes a
+// single attempt; the letter is removed once it succeeds.
+func handleAdminDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if jobs == nil {
+		http.Error(w, "Jobs are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/webhooks/dead-letters"), "/")
+	if rest == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs.deadLetters.List())
+		return
+	}
+
+	deliveryID, action, _ := strings.Cut(rest, "/")
+	if action != "replay" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	letter, ok := jobs.deadLetters.Get(deliveryID)
+	if !ok {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+
+	err := deliverWebhook(r.Context(), letter.URL, letter.DeliveryID, letter.Payload)
+	jobs.deadLetters.Resolve(letter.DeliveryID, err)
+	if err != nil {
+		webhookDeliveries.Inc("failed")
+		log.Printf("Webhooks: replaying delivery %s: %v", letter.DeliveryID, err)
+		http.Error(w, fmt.Sprintf("Delivery failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	webhookDeliveries.Inc("delivered")
+	log.Printf("Webhooks: replayed delivery %s via admin endpoint", letter.DeliveryID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"delivery_id": letter.DeliveryID, "delivered": true})
+}
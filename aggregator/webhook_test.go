@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setWebhookConfig overrides the WEBHOOK_* settings for one test, letting
+// callbacks reach the loopback test servers.
+func setWebhookConfig(t *testing.T, retries int) {
+	t.Helper()
+	oldSecret, oldRetries, oldBackoff, oldMax, oldNetworks := webhookSecret, webhookRetries, webhookBackoff, webhookMaxBackoff, webhookAllowedNetworks
+	t.Cleanup(func() {
+		webhookSecret, webhookRetries, webhookBackoff, webhookMaxBackoff, webhookAllowedNetworks = oldSecret, oldRetries, oldBackoff, oldMax, oldNetworks
+	})
+	webhookSecret = "test secret"
+	webhookRetries = retries
+	webhookBackoff, webhookMaxBackoff = time.Millisecond, time.Millisecond
+	webhookAllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+}
+
+// finishedJob returns a done job that calls back to callbackURL.
+func finishedJob(id, callbackURL string) *job {
+	now := time.Now().UTC()
+	return &job{rec: jobRecord{
+		ID: id, Status: JobDone, CreatedAt: now, UpdatedAt: now, FinishedAt: &now,
+		CallbackURL: callbackURL, DeliveryID: "delivery-" + id,
+	}}
+}
+
+func TestDeliverWebhookSignature(t *testing.T) {
+	setWebhookConfig(t, 0)
+	var got struct {
+		body                           []byte
+		delivery, timestamp, signature string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.body, _ = io.ReadAll(r.Body)
+		got.delivery = r.Header.Get("X-Aggregator-Delivery")
+		got.timestamp = r.Header.Get("X-Aggregator-Timestamp")
+		got.signature = r.Header.Get("X-Aggregator-Signature")
+	}))
+	t.Cleanup(srv.Close)
+
+	payload := []byte(`{"id":"job"}`)
+	if err := deliverWebhook(context.Background(), srv.URL, "delivery", payload); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.body) != string(payload) || got.delivery != "delivery" {
+		t.Errorf("got body %s, delivery %q", got.body, got.delivery)
+	}
+	if sent, err := strconv.ParseInt(got.timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)).Abs() > time.Minute {
+		t.Errorf("timestamp = %q, want the current Unix time", got.timestamp)
+	}
+
+	// Receivers check the HMAC of "<timestamp>.<body>".
+	mac := hmac.New(sha256.New, []byte("test secret"))
+	mac.Write([]byte(got.timestamp + "." + string(got.body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.signature != want {
+		t.Errorf("signature = %q, want %q", got.signature, want)
+	}
+	if other := signPayload(got.timestamp+"0", payload); other == got.signature {
+		t.Error("signature does not cover the timestamp")
+	}
+}
+
+func TestNotifyRetriesThenDeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int32
+	}{
+		{"unavailable", http.StatusServiceUnavailable, 3},
+		{"too many requests", http.StatusTooManyRequests, 3},
+		{"bad request", http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setWebhookConfig(t, 2)
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			t.Cleanup(srv.Close)
+			dir := t.TempDir()
+			s, err := openJobStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			j := finishedJob("failing", srv.URL)
+			s.notify(context.Background(), j)
+			if n := attempts.Load(); n != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", n, tt.wantAttempts)
+			}
+			if !j.rec.Notified {
+				t.Error("job not marked notified")
+			}
+			letter, ok := s.deadLetters.Get("delivery-failing")
+			if !ok {
+				t.Fatal("no dead letter")
+			}
+			if letter.JobID != "failing" || letter.URL != srv.URL || letter.Attempts != int(tt.wantAttempts) || !strings.Contains(letter.Error, "status") || len(letter.Payload) == 0 {
+				t.Errorf("dead letter = %+v", letter)
+			}
+
+			reopened, err := openDeadLetterStore(filepath.Join(dir, "webhooks"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := reopened.Get("delivery-failing"); !ok {
+				t.Error("dead letter not saved")
+			}
+		})
+	}
+}
+
+func TestNotifyRetriesUntilDelivered(t *testing.T) {
+	setWebhookConfig(t, 2)
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	s, err := openJobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := finishedJob("flaky", srv.URL)
+	s.notify(context.Background(), j)
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+	if !j.rec.Notified {
+		t.Error("job not marked notified")
+	}
+	if letters := s.deadLetters.List(); len(letters) != 0 {
+		t.Errorf("dead letters = %+v", letters)
+	}
+}
+
+// A delivery cut short by its context is neither dead-lettered nor
+// marked done, so the next start delivers it again.
+func TestNotifyStopsWithContext(t *testing.T) {
+	setWebhookConfig(t, 100)
+	webhookBackoff, webhookMaxBackoff = time.Hour, time.Hour
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	dir := t.TempDir()
+	s, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	j := finishedJob("stopped", srv.URL)
+	done := make(chan struct{})
+	go func() {
+		s.notify(ctx, j)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notify did not stop with its context")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+	if j.rec.Notified {
+		t.Error("job marked notified")
+	}
+	if letters := s.deadLetters.List(); len(letters) != 0 {
+		t.Errorf("dead letters = %+v", letters)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "webhooks", "dead-letters.json")); !os.IsNotExist(err) {
+		t.Errorf("dead letters written: %v", err)
+	}
+}
+
+func TestCheckCallbackDial(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed []string
+		want    bool
+	}{
+		{"93.184.216.34:443", nil, true},
+		{"[2606:4700::1111]:443", nil, true},
+		{"127.0.0.1:80", nil, false},
+		{"[::1]:80", nil, false},
+		{"[::ffff:127.0.0.1]:80", nil, false},
+		{"10.1.2.3:80", nil, false},
+		{"172.16.0.1:80", nil, false},
+		{"192.168.1.1:80", nil, false},
+		{"169.254.169.254:80", nil, false},
+		{"100.64.0.1:80", nil, false},
+		{"0.0.0.0:80", nil, false},
+		{"[fd00::1]:80", nil, false},
+		{"10.1.2.3:80", []string{"10.0.0.0/8"}, true},
+		{"192.168.1.1:80", []string{"10.0.0.0/8"}, false},
+		{"127.0.0.1:8080", []string{"127.0.0.1/32"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address+"/"+strings.Join(tt.allowed, ","), func(t *testing.T) {
+			t.Setenv("WEBHOOK_ALLOWED_NETWORKS", strings.Join(tt.allowed, ","))
+			saved := webhookAllowedNetworks
+			t.Cleanup(func() { webhookAllowedNetworks = saved })
+			webhookAllowedNetworks = mustParsePrefixes("WEBHOOK_ALLOWED_NETWORKS")
+
+			err := checkCallbackDial("tcp", tt.address, nil)
+			if tt.want && err != nil {
+				t.Errorf("got %v, want allowed", err)
+			}
+			if !tt.want && !errors.Is(err, errCallbackAddress) {
+				t.Errorf("got %v, want %v", err, errCallbackAddress)
+			}
+		})
+	}
+}
+
+// The dial check also holds for addresses a host name resolves to.
+func TestWebhookClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("callback reached a loopback receiver")
+	}))
+	t.Cleanup(srv.Close)
+	saved := webhookAllowedNetworks
+	t.Cleanup(func() { webhookAllowedNetworks = saved })
+	webhookAllowedNetworks = nil
+
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	err := deliverWebhook(context.Background(), url, "delivery", []byte(`{}`))
+	if !errors.Is(err, errCallbackAddress) {
+		t.Errorf("got %v, want %v", err, errCallbackAddress)
+	}
+	if retryable(err) {
+		t.Error("refused callback is retryable")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+type OpRequest struct {
+	Text *string `json:"text,omitempty"`
+	Deps *struct {
+		Normalized     *string  `json:"normalized,omitempty"`
+		Transliterated *string  `json:"transliterated,omitempty"`
+		Tokens         []string `json:"tokens,omitempty"`
+		// TokensTruncated is the tokenizer's truncated flag: set when
+		// Tokens misses words or holds shortened ones.
+		TokensTruncated *bool `json:"tokens_truncated,omitempty"`
+	} `json:"deps,omitempty"`
+	Options *struct {
+		// Tables asks for the frequency tables next to the counts.
+		Tables *bool `json:"tables,omitempty"`
+	} `json:"options,omitempty"`
+}
+
+type OpResponse struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+	CacheHit bool        `json:"cache_hit"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type ValidationResult struct {
+	Valid bool
+	Error string
+}
+
+// Global request counter
+var requestCounter int64
+
+func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+
+	http.HandleFunc("/op", handleOp)
+	http.HandleFunc("/healthz", handleHealth)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting counter gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
+
+	log.Println("Starting counter server on :8080...")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+func handleOp(w http.ResponseWriter, r *http.Request) {
+	// Increment request counter
+	atomic.AddInt64(&requestCounter, 1)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req OpRequest
+	var validationResult ValidationResult
+
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
+		validationResult = ValidationResult{
+			Valid: false,
+			Error: err.Error(),
+		}
+	} else {
+		validationResult = validateInput(req)
+	}
+
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
+	var countsValue interface{}
+	var errorMsg string
+
+	if !validationResult.Valid {
+		countsValue = nil
+		errorMsg = validationResult.Error
+	} else {
+		// Use deps.normalized if available, otherwise use text
+		var inputText string
+		var hasInput bool
+
+		if req.Deps != nil && req.Deps.Normalized != nil && *req.Deps.Normalized != "" {
+			inputText = *req.Deps.Normalized
+			hasInput = true
+		} else if req.Text != nil && *req.Text != "" {
+			inputText = *req.Text
+			hasInput = true
+		}
+
+		if hasInput {
+			// Additional runtime validation
+			if len(inputText) > 10000 {
+				countsValue = nil
+				errorMsg = "Input text too long (max 10000 characters)"
+			} else {
+				// Use deps.tokens if available and not cut by the
+				// tokenizer, otherwise tokenize here
+				var tokens []string
+				if req.Deps != nil && req.Deps.Tokens != nil && (req.Deps.TokensTruncated == nil || !*req.Deps.TokensTruncated) {
+					tokens = req.Deps.Tokens
+				} else {
+					tokens = tokenize(inputText)
+				}
+				tables := req.Options != nil && req.Options.Tables != nil && *req.Options.Tables
+				countsValue = countText(inputText, tokens, tables)
+			}
+		} else {
+			countsValue = nil
+			errorMsg = "No normalized text in deps or text provided"
+		}
+	}
+
+	response := OpResponse{
+		Key:      "counts",
+		Value:    countsValue,
+		CacheHit: false,
+	}
+
+	// Include error message if present
+	if errorMsg != "" {
+		response.Error = errorMsg
+	}
+
+	return response
+}
+
+// validateInput performs comprehensive input validation
+func validateInput(req OpRequest) ValidationResult {
+	// Check if request is completely empty
+	if req.Text == nil && req.Deps == nil {
+		return ValidationResult{
+			Valid: false,
+			Error: "Request body must contain either 'text' or 'deps' field",
+		}
+	}
+
+	// Validate text field if present
+	if req.Text != nil {
+		if len(*req.Text) == 0 {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text field cannot be empty string",
+			}
+		}
+
+		// Check for invalid characters or encoding issues
+		if !isValidUTF8(*req.Text) {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text contains invalid UTF-8 characters",
+			}
+		}
+	}
+
+	// Validate deps structure if present
+	if req.Deps != nil {
+		if err := validateDeps(*req.Deps); err != "" {
+			return ValidationResult{
+				Valid: false,
+				Error: err,
+			}
+		}
+	}
+
+	return ValidationResult{Valid: true, Error: ""}
+}
+
+// validateDeps validates the deps structure
+func validateDeps(deps struct {
+	Normalized      *string  `json:"normalized,omitempty"`
+	Transliterated  *string  `json:"transliterated,omitempty"`
+	Tokens          []string `json:"tokens,omitempty"`
+	TokensTruncated *bool    `json:"tokens_truncated,omitempty"`
+}) string {
+	// Validate normalized field
+	if deps.Normalized != nil && len(*deps.Normalized) > 10000 {
+		return "deps.normalized too long (max 10000 characters)"
+	}
+
+	// Validate transliterated field
+	if deps.Transliterated != nil && len(*deps.Transliterated) > 10000 {
+		return "deps.transliterated too long (max 10000 characters)"
+	}
+
+	// Validate tokens array
+	if len(deps.Tokens) > 1000 {
+		return "deps.tokens array too large (max 1000 items)"
+	}
+
+	for i, token := range deps.Tokens {
+		if len(token) > 100 {
+			return fmt.Sprintf("deps.tokens[%d] too long (max 100 characters)", i)
+		}
+	}
+
+	return ""
+}
+
+// isValidUTF8 checks if string contains valid UTF-8
+func isValidUTF8(s string) bool {
+	for _, r := range s {
+		if r == unicode.ReplacementChar {
+			return false
+		}
+	}
+	return true
+}
+
+// countText builds the op's value: the number of distinct words, of
+// distinct word bigrams and of distinct characters. Words are compared
+// case-insensitively. Characters are grapheme clusters of the NFC form, so
+// "é" counts once however it is encoded and whitespace is left out. With
+// tables, the frequency of every word, bigram ("a b") and character is
+// included too.
+func countText(text string, tokens []string, tables bool) map[string]interface{} {
+	words := make(map[string]int)
+	bigrams := make(map[string]int)
+	previous := ""
+	for i, token := range tokens {
+		word := norm.NFC.String(strings.ToLower(token))
+		words[word]++
+		if i > 0 {
+			bigrams[previous+" "+word]++
+		}
+		previous = word
+	}
+
+	chars := make(map[string]int)
+	text = norm.NFC.String(text)
+	state := -1
+	for len(text) > 0 {
+		var cluster string
+		cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		if strings.TrimSpace(cluster) == "" {
+			continue
+		}
+		chars[cluster]++
+	}
+
+	counts := map[string]interface{}{
+		"unique_words": len(words),
+		"bigram_count": len(bigrams),
+		"unique_chars": len(chars),
+	}
+	if tables {
+		counts["word_frequencies"] = frequencyTable(words)
+		counts["bigram_frequencies"] = frequencyTable(bigrams)
+		counts["char_frequencies"] = frequencyTable(chars)
+	}
+	return counts
+}
+
+// frequencyTable converts counts to the map[string]interface{} form that
+// both encoding/json and structpb accept.
+func frequencyTable(counts map[string]int) map[string]interface{} {
+	table := make(map[string]interface{}, len(counts))
+	for key, n := range counts {
+		table[key] = n
+	}
+	return table
+}
+
+// tokenize splits s into words following the Unicode word boundary rules
+// (UAX #29), the way the tokenizer op does. Segments made only of spaces,
+// punctuation or symbols are dropped.
+func tokenize(s string) []string {
+	var tokens []string
+	state := -1
+	for len(s) > 0 {
+		var word string
+		word, s, state = uniseg.FirstWordInString(s, state)
+		if isWord(word) {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// isWord reports whether a segment contains a letter or a digit.
+func isWord(segment string) bool {
+	for _, r := range segment {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count := atomic.LoadInt64(&requestCounter)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "# HELP op_requests_total Total number of requests to /op endpoint\n")
+	fmt.Fprintf(w, "# TYPE op_requests_total counter\n")
+	fmt.Fprintf(w, "op_requests_total %d\n", count)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"entropy/oppb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// opServer serves the op over gRPC. It shares runOp, and so its
+// validation and behaviour, with /op.
+type opServer struct {
+	oppb.UnimplementedOpServer
+}
+
+func (opServer) Run(ctx context.Context, in *oppb.OpRequest) (*oppb.OpResponse, error) {
+	atomic.AddInt64(&requestCounter, 1)
+
+	var req OpRequest
+	var validationResult ValidationResult
+
+	if err := fromProto(in, &req); err != nil {
+		validationResult = ValidationResult{
+			Valid: false,
+			Error: err.Error(),
+		}
+	} else {
+		validationResult = validateInput(req)
+	}
+
+	response := runOp(req, validationResult)
+
+	value, err := structpb.NewValue(response.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &oppb.OpResponse{
+		Key:      response.Key,
+		Value:    value,
+		CacheHit: response.CacheHit,
+		Error:    response.Error,
+	}, nil
+}
+
+// fromProto converts a gRPC request into the JSON form /op decodes, so
+// both see the same validation, deps and options.
+func fromProto(in *oppb.OpRequest, req *OpRequest) error {
+	fields := make(map[string]interface{}, 3)
+	if in.Text != nil {
+		fields["text"] = *in.Text
+	}
+	if in.Deps != nil {
+		fields["deps"] = in.Deps.AsMap()
+	}
+	if in.Options != nil {
+		fields["options"] = in.Options.AsMap()
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("Invalid request: %v", err)
+	}
+	return decodeOpRequest(data, req)
+}
+
+// serveGRPC serves the Op service, the standard health service and server
+// reflection on addr.
+func serveGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	oppb.RegisterOpServer(server, opServer{})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server.Serve(lis)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/text/unicode/norm"
+)
+
+type OpRequest struct {
+	Text *string `json:"text,omitempty"`
+	Deps *struct {
+		Normalized     *string  `json:"normalized,omitempty"`
+		Transliterated *string  `json:"transliterated,omitempty"`
+		Tokens         []string `json:"tokens,omitempty"`
+	} `json:"deps,omitempty"`
+	Options *struct {
+		// Algorithm names the hash to compute, defaultAlgorithm if unset.
+		Algorithm *string `json:"algorithm,omitempty"`
+	} `json:"options,omitempty"`
+}
+
+type OpResponse struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+	CacheHit bool        `json:"cache_hit"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type ValidationResult struct {
+	Valid bool
+	Error string
+}
+
+// Global request counter
+var requestCounter int64
+
+// defaultAlgorithm is the hash computed when the request names none. It
+// is part of the op's contract and must not change.
+const defaultAlgorithm = "xxhash64"
+
+// hashAlgorithms maps each algorithm name to its hash function. Hashes are
+// kept as dedup keys, so the hash of a given input under a given name must
+// never change: an algorithm may be added under a new name, but an existing
+// entry is never altered or reused.
+var hashAlgorithms = map[string]func(data []byte) []byte{
+	// FNV-1a, 64 bits, big-endian.
+	"fnv1a64": func(data []byte) []byte {
+		h := fnv.New64a()
+		h.Write(data)
+		return h.Sum(nil)
+	},
+	// xxHash64 (XXH64) with seed 0, big-endian.
+	"xxhash64": func(data []byte) []byte {
+		return binary.BigEndian.AppendUint64(nil, xxhash.Sum64(data))
+	},
+	"sha256": func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	},
+	// Unkeyed BLAKE2b with a 256-bit digest.
+	"blake2b256": func(data []byte) []byte {
+		sum := blake2b.Sum256(data)
+		return sum[:]
+	},
+}
+
+// knownAnswers holds the hash of "hello" under every algorithm. The service
+// refuses to start if any of them differs, so a dependency upgrade cannot
+// silently change the hashes it hands out.
+var knownAnswers = map[string]string{
+	"fnv1a64":    "a430d84680aabd0b",
+	"xxhash64":   "26c7827d889f6da3",
+	"sha256":     "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	"blake2b256": "324dcf027dd4a30a932c441f365a25e86b173defa4b8e58948253471b81b72cf",
+}
+
+func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+	if err := checkKnownAnswers(); err != nil {
+		log.Fatalf("Checking hash algorithms: %v", err)
+	}
+
+	http.HandleFunc("/op", handleOp)
+	http.HandleFunc("/healthz", handleHealth)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting hasher gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
+
+	log.Println("Starting hasher server on :8080...")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+func handleOp(w http.ResponseWriter, r *http.Request) {
+	// Increment request counter
+	atomic.AddInt64(&requestCounter, 1)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req OpRequest
+	var validationResult ValidationResult
+
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
+		validationResult = ValidationResult{
+			Valid: false,
+			Error: err.Error(),
+		}
+	} else {
+		validationResult = validateInput(req)
+	}
+
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
+	var hashValue interface{}
+	var errorMsg string
+
+	if !validationResult.Valid {
+		hashValue = nil
+		errorMsg = validationResult.Error
+	} else {
+		// Use deps.normalized if available, otherwise normalize text
+		// here: the hash is of the normalized text either way, so that
+		// it does not depend on whether the normalizer ran.
+		var inputText string
+		var hasInput bool
+
+		if req.Deps != nil && req.Deps.Normalized != nil && *req.Deps.Normalized != "" {
+			inputText = *req.Deps.Normalized
+			hasInput = true
+		} else if req.Text != nil && *req.Text != "" {
+			inputText = normalizeText(*req.Text)
+			hasInput = inputText != ""
+		}
+
+		if hasInput {
+			// Additional runtime validation
+			if len(inputText) > 10000 {
+				hashValue = nil
+				errorMsg = "Input text too long (max 10000 characters)"
+			} else {
+				algorithm := defaultAlgorithm
+				if req.Options != nil && req.Options.Algorithm != nil {
+					algorithm = *req.Options.Algorithm
+				}
+				hash, err := hashText(inputText, algorithm)
+				if err != nil {
+					hashValue = nil
+					errorMsg = err.Error()
+				} else {
+					hashValue = hash
+				}
+			}
+		} else {
+			hashValue = nil
+			errorMsg = "No normalized text in deps or text provided"
+		}
+	}
+
+	response := OpResponse{
+		Key:      "hash",
+		Value:    hashValue,
+		CacheHit: false,
+	}
+
+	// Include error message if present
+	if errorMsg != "" {
+		response.Error = errorMsg
+	}
+
+	return response
+}
+
+// validateInput performs comprehensive input validation
+func validateInput(req OpRequest) ValidationResult {
+	// Check if request is completely empty
+	if req.Text == nil && req.Deps == nil {
+		return ValidationResult{
+			Valid: false,
+			Error: "Request body must contain either 'text' or 'deps' field",
+		}
+	}
+
+	// Validate text field if present
+	if req.Text != nil {
+		if len(*req.Text) == 0 {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text field cannot be empty string",
+			}
+		}
+
+		// Check for invalid characters or encoding issues
+		if !isValidUTF8(*req.Text) {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text contains invalid UTF-8 characters",
+			}
+		}
+	}
+
+	// Validate deps structure if present
+	if req.Deps != nil {
+		if err := validateDeps(*req.Deps); err != "" {
+			return ValidationResult{
+				Valid: false,
+				Error: err,
+			}
+		}
+	}
+
+	return ValidationResult{Valid: true, Error: ""}
+}
+
+// validateDeps validates the deps structure
+func validateDeps(deps struct {
+	Normalized     *string  `json:"normalized,omitempty"`
+	Transliterated *string  `json:"transliterated,omitempty"`
+	Tokens         []string `json:"tokens,omitempty"`
+}) string {
+	// Validate normalized field
+	if deps.Normalized != nil && len(*deps.Normalized) > 10000 {
+		return "deps.normalized too long (max 10000 characters)"
+	}
+
+	// Validate transliterated field
+	if deps.Transliterated != nil && len(*deps.Transliterated) > 10000 {
+		return "deps.transliterated too long (max 10000 characters)"
+	}
+
+	// Validate tokens array
+	if len(deps.Tokens) > 1000 {
+		return "deps.tokens array too large (max 1000 items)"
+	}
+
+	for i, token := range deps.Tokens {
+		if len(token) > 100 {
+			return fmt.Sprintf("deps.tokens[%d] too long (max 100 characters)", i)
+		}
+	}
+
+	return ""
+}
+
+// isValidUTF8 checks if string contains valid UTF-8
+func isValidUTF8(s string) bool {
+	for _, r := range s {
+		if r == unicode.ReplacementChar {
+			return false
+		}
+	}
+	return true
+}
+
+// hashText returns the hash of text's UTF-8 bytes under algorithm as
+// lowercase hex.
+func hashText(text, algorithm string) (string, error) {
+	hash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("Unknown algorithm %q", algorithm)
+	}
+	return hex.EncodeToString(hash([]byte(text))), nil
+}
+
+// Copied from normalizer/main.go. TestNormalizeTextMatchesNormalizer checks
+// that the copy still agrees with the normalizer.
+
+// normalizeText applies NFKC normalization, lowercasing, whitespace collapsing, and diacritic stripping
+func normalizeText(s string) string {
+	// NFKC normalization
+	imported := norm.NFKC.String(s)
+	// Lowercase
+	imported = strings.ToLower(imported)
+	// Collapse whitespace
+	imported = strings.Join(strings.Fields(imported), " ")
+	// Strip diacritics
+	imported = stripDiacritics(imported)
+	return imported
+}
+
+func stripDiacritics(s string) string {
+	t := norm.NFD.String(s)
+	out := make([]rune, 0, len(t))
+	for _, r := range t {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// checkKnownAnswers hashes "hello" under every algorithm and compares the
+// result with knownAnswers.
+func checkKnownAnswers() error {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want, ok := knownAnswers[name]
+		if !ok {
+			return fmt.Errorf("%s has no known answer", name)
+		}
+		if got, _ := hashText("hello", name); got != want {
+			return fmt.Errorf("%s(\"hello\") = %s, want %s", name, got, want)
+		}
+	}
+	return nil
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count := atomic.LoadInt64(&requestCounter)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "# HELP op_requests_total Total number of requests to /op endpoint\n")
+	fmt.Fprintf(w, "# TYPE op_requests_total counter\n")
+	fmt.Fprintf(w, "op_requests_total %d\n", count)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// goldenVectors were computed independently of this package: sha256 and
+// blake2b256 with Python's hashlib, fnv1a64 and xxhash64 with reference
+// implementations of FNV-1a and XXH64 (seed 0).
+var goldenVectors = []struct {
+	text string
+	want map[string]string
+}{
+	{"", map[string]string{
+		"fnv1a64":    "cbf29ce484222325",
+		"xxhash64":   "ef46db3751d8e999",
+		"sha256":     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"blake2b256": "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8",
+	}},
+	{"hello", map[string]string{
+		"fnv1a64":    "a430d84680aabd0b",
+		"xxhash64":   "26c7827d889f6da3",
+		"sha256":     "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"blake2b256": "324dcf027dd4a30a932c441f365a25e86b173defa4b8e58948253471b81b72cf",
+	}},
+	{"καλημέρα κόσμε", map[string]string{
+		"fnv1a64":    "63b6f365d98d78f4",
+		"xxhash64":   "a307372a2f861128",
+		"sha256":     "6de7ecac9a886c9e177bcfadd374fd0242d913fb373e2190a705ad684525df71",
+		"blake2b256": "148012e8195a52ee98cbeab032cbd52101249dde703c22da3693bf994be6879a",
+	}},
+	{"naïve café", map[string]string{
+		"fnv1a64":    "459a9306a3b06b55",
+		"xxhash64":   "f72d341b0c4bd8a6",
+		"sha256":     "28e86ad89c14d1298f1961e890fc980ac80a0288e949e02557b3bfd04a5efc02",
+		"blake2b256": "ad74d02f06ca3accd15590c2064099aaa4e60826a07be74c6580df4ed125a1c5",
+	}},
+	{"日本語のテキスト", map[string]string{
+		"fnv1a64":    "d081b6dd042245ed",
+		"xxhash64":   "fcef3a62b7d1663b",
+		"sha256":     "d4192d3b01dfa9f5b08388f13e5c7492e3cfdc5611bf8c77784dc97523f03efb",
+		"blake2b256": "b35dbb8079deef2d1a22803999284a175e9db4ee93f5741bf855c45666198720",
+	}},
+	{"👍🏽 ok", map[string]string{
+		"fnv1a64":    "570f0db69c2fa903",
+		"xxhash64":   "464d5d6b78d342ef",
+		"sha256":     "b52b010b8fee98e4d92255bfcf6242b47746c17686026e2dc47c8b4fe6f27b86",
+		"blake2b256": "a5191b416c9db71cbd04c08fad3b6e3e77efb82b8b1a16915d24ca96e002f81b",
+	}},
+	// Long enough for XXH64's 32-byte stripes.
+	{"the quick brown fox jumps over the lazy dog, twice over", map[string]string{
+		"fnv1a64":    "23dee238813c6dc2",
+		"xxhash64":   "7d2cc00a01d1fe13",
+		"sha256":     "b2e46c3cb2d31cf7554279aba4fb02cdc7e5e9ff7611d5250c7130f862491c94",
+		"blake2b256": "29588eec10f4d4d2da91d445c8f7ab38d891d73267bc3b8453e8b225f70cc099",
+	}},
+}
+
+func TestHashTextGoldenVectors(t *testing.T) {
+	for _, vector := range goldenVectors {
+		if len(vector.want) != len(hashAlgorithms) {
+			t.Fatalf("%q: %d vectors for %d algorithms", vector.text, len(vector.want), len(hashAlgorithms))
+		}
+		for algorithm, want := range vector.want {
+			got, err := hashText(vector.text, algorithm)
+			if err != nil {
+				t.Fatalf("%s(%q): %v", algorithm, vector.text, err)
+			}
+			if got != want {
+				t.Errorf("%s(%q) = %s, want %s", algorithm, vector.text, got, want)
+			}
+		}
+	}
+}
+
+func TestCheckKnownAnswers(t *testing.T) {
+	if err := checkKnownAnswers(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashTextUnknownAlgorithm(t *testing.T) {
+	if _, err := hashText("hello", "md5"); err == nil {
+		t.Error("md5: got no error")
+	}
+}
+
+// Without deps.normalized the op hashes the text normalized the way the
+// normalizer would, not the raw text.
+func TestRunOpNormalizesText(t *testing.T) {
+	// sha256("naive cafe")
+	const want = "379f02434e69f09fbeb28024fac8edc167b0a6501fa415fb963724ce4123d122"
+	for _, body := range []string{
+		`{"text": "  Naïve   CAFÉ ", "options": {"algorithm": "sha256"}}`,
+		`{"text": "ignored", "deps": {"normalized": "naive cafe"}, "options": {"algorithm": "sha256"}}`,
+	} {
+		var req OpRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		response := runOp(req, validateInput(req))
+		if response.Error != "" || response.Value != want {
+			t.Errorf("%s: got %v (error %q), want %s", body, response.Value, response.Error, want)
+		}
+	}
+}
+
+// TestNormalizeTextMatchesNormalizer runs the copy of normalizeText over
+// the normalizer's own test cases, so the two cannot drift apart.
+func TestNormalizeTextMatchesNormalizer(t *testing.T) {
+	data, err := os.ReadFile("../normalizer/testdata/normalize.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Text       string `json:"text"`
+		Normalized string `json:"normalized"`
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if got := normalizeText(c.Text); got != c.Normalized {
+			t.Errorf("normalizeText(%q) = %q, normalizer gives %q", c.Text, got, c.Normalized)
+		}
+	}
+}
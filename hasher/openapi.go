@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// openapiJSON describes the service and is served on /openapi.json.
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+// opRequestSchema is the OpRequest schema of openapiJSON; /op and the gRPC
+// Run method validate requests against it.
+var opRequestSchema *openapi3.Schema
+
+func loadOpenAPI() error {
+	doc, err := openapi3.NewLoader().LoadFromData(openapiJSON)
+	if err != nil {
+		return err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return err
+	}
+	opRequestSchema = doc.Components.Schemas["OpRequest"].Value
+	return nil
+}
+
+// decodeOpRequest validates data against the OpRequest schema and decodes
+// it into req. Schema violations are reported with the JSON path of the
+// offending value, e.g. "$.deps.tokens[3]".
+func decodeOpRequest(data []byte, req *OpRequest) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("Invalid JSON: %v", err)
+	}
+	if err := opRequestSchema.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		return fmt.Errorf("Invalid request: %s", describeSchemaError(err))
+	}
+	if err := json.Unmarshal(data, req); err != nil {
+		return fmt.Errorf("Invalid request: %v", err)
+	}
+	return nil
+}
+
+// describeSchemaError lists every violation in err as "<path>: <reason>",
+// sorted by path.
+func describeSchemaError(err error) string {
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+	var messages []string
+	for _, err := range errs {
+		var schemaErr *openapi3.SchemaError
+		if errors.As(err, &schemaErr) {
+			reason := schemaErr.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("does not match %q", schemaErr.SchemaField)
+			}
+			messages = append(messages, jsonPath(schemaErr.JSONPointer())+": "+reason)
+			continue
+		}
+		var nested openapi3.MultiError
+		if errors.As(err, &nested) {
+			messages = append(messages, describeSchemaError(nested))
+			continue
+		}
+		messages = append(messages, err.Error())
+	}
+	sort.Strings(messages)
+	return strings.Join(messages, "; ")
+}
+
+// jsonPath turns a JSON pointer's tokens into a path such as
+// "$.deps.tokens[3]".
+func jsonPath(pointer []string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, token := range pointer {
+		if _, err := strconv.Atoi(token); err == nil {
+			b.WriteString("[" + token + "]")
+		} else {
+			b.WriteString("." + token)
+		}
+	}
+	return b.String()
+}
+
+// handleOpenAPI serves the OpenAPI document.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiJSON)
+}
@@ -0,0 +1,67 @@
+//go:build ignore
+
+// gen_profiles builds the language profiles in profiles/ from the sample
+// texts in corpus/. Run it with go generate after changing the corpus.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileSize is the number of n-grams kept per language, the most
+// frequent first.
+const profileSize = 3000
+
+func main() {
+	paths, err := filepath.Glob("corpus/*.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, path := range paths {
+		if err := generateProfile(path); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+}
+
+// generateProfile writes the profile of the corpus at path to
+// profiles/<language>.txt. The first line gives the number of n-grams in
+// the corpus, and every other line an n-gram and its count.
+func generateProfile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	grams := ngrams(string(data))
+	for _, gram := range grams {
+		counts[gram]++
+	}
+	ranked := make([]string, 0, len(counts))
+	for gram := range counts {
+		ranked = append(ranked, gram)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if counts[ranked[i]] != counts[ranked[j]] {
+			return counts[ranked[i]] > counts[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if len(ranked) > profileSize {
+		ranked = ranked[:profileSize]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# total %d\n", len(grams))
+	for _, gram := range ranked {
+		fmt.Fprintf(&b, "%s\t%d\n", gram, counts[gram])
+	}
+	out := filepath.Join("profiles", filepath.Base(path))
+	return os.WriteFile(out, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"unicode"
+)
+
+type OpRequest struct {
+	Text *string `json:"text,omitempty"`
+	Deps *struct {
+		Normalized     *string  `json:"normalized,omitempty"`
+		Transliterated *string  `json:"transliterated,omitempty"`
+		Tokens         []string `json:"tokens,omitempty"`
+	} `json:"deps,omitempty"`
+	Options *struct {
+		// MaxGuesses caps the guesses returned, defaultMaxGuesses if unset.
+		MaxGuesses *int `json:"max_guesses,omitempty"`
+	} `json:"options,omitempty"`
+}
+
+type OpResponse struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+	CacheHit bool        `json:"cache_hit"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type ValidationResult struct {
+	Valid bool
+	Error string
+}
+
+// Global request counter
+var requestCounter int64
+
+// defaultMaxGuesses is the number of guesses returned when the request
+// does not say.
+const defaultMaxGuesses = 3
+
+// undetermined is the ISO 639-2 code reported when no language could be
+// identified.
+const undetermined = "und"
+
+// minConfidence is the confidence the best guess needs to be reported as
+// the language; below it the text is too short or too ambiguous, and the
+// language is undetermined.
+const minConfidence = 0.5
+
+func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+	if err := loadProfiles(); err != nil {
+		log.Fatalf("Loading language profiles: %v", err)
+	}
+
+	http.HandleFunc("/op", handleOp)
+	http.HandleFunc("/healthz", handleHealth)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting langid gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
+
+	log.Println("Starting langid server on :8080...")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+func handleOp(w http.ResponseWriter, r *http.Request) {
+	// Increment request counter
+	atomic.AddInt64(&requestCounter, 1)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req OpRequest
+	var validationResult ValidationResult
+
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
+		validationResult = ValidationResult{
+			Valid: false,
+			Error: err.Error(),
+		}
+	} else {
+		validationResult = validateInput(req)
+	}
+
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
+	var languageValue interface{}
+	var errorMsg string
+
+	if !validationResult.Valid {
+		languageValue = nil
+		errorMsg = validationResult.Error
+	} else {
+		// Use text if available, otherwise deps.normalized: normalizing
+		// strips the diacritics that tell many languages apart
+		var inputText string
+		var hasInput bool
+
+		if req.Text != nil && *req.Text != "" {
+			inputText = *req.Text
+			hasInput = true
+		} else if req.Deps != nil && req.Deps.Normalized != nil && *req.Deps.Normalized != "" {
+			inputText = *req.Deps.Normalized
+			hasInput = true
+		}
+
+		if hasInput {
+			// Additional runtime validation
+			if len(inputText) > 10000 {
+				languageValue = nil
+				errorMsg = "Input text too long (max 10000 characters)"
+			} else {
+				maxGuesses := defaultMaxGuesses
+				if req.Options != nil && req.Options.MaxGuesses != nil {
+					maxGuesses = *req.Options.MaxGuesses
+				}
+				languageValue = languageResult(identify(inputText), maxGuesses)
+			}
+		} else {
+			languageValue = nil
+			errorMsg = "No normalized text in deps or text provided"
+		}
+	}
+
+	response := OpResponse{
+		Key:      "language",
+		Value:    languageValue,
+		CacheHit: false,
+	}
+
+	// Include error message if present
+	if errorMsg != "" {
+		response.Error = errorMsg
+	}
+
+	return response
+}
+
+// validateInput performs comprehensive input validation
+func validateInput(req OpRequest) ValidationResult {
+	// Check if request is completely empty
+	if req.Text == nil && req.Deps == nil {
+		return ValidationResult{
+			Valid: false,
+			Error: "Request body must contain either 'text' or 'deps' field",
+		}
+	}
+
+	// Validate text field if present
+	if req.Text != nil {
+		if len(*req.Text) == 0 {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text field cannot be empty string",
+			}
+		}
+
+		// Check for invalid characters or encoding issues
+		if !isValidUTF8(*req.Text) {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text contains invalid UTF-8 characters",
+			}
+		}
+	}
+
+	// Validate deps structure if present
+	if req.Deps != nil {
+		if err := validateDeps(*req.Deps); err != "" {
+			return ValidationResult{
+				Valid: false,
+				Error: err,
+			}
+		}
+	}
+
+	return ValidationResult{Valid: true, Error: ""}
+}
+
+// validateDeps validates the deps structure
+func validateDeps(deps struct {
+	Normalized     *string  `json:"normalized,omitempty"`
+	Transliterated *string  `json:"transliterated,omitempty"`
+	Tokens         []string `json:"tokens,omitempty"`
+}) string {
+	// Validate normalized field
+	if deps.Normalized != nil && len(*deps.Normalized) > 10000 {
+		return "deps.normalized too long (max 10000 characters)"
+	}
+
+	// Validate transliterated field
+	if deps.Transliterated != nil && len(*deps.Transliterated) > 10000 {
+		return "deps.transliterated too long (max 10000 characters)"
+	}
+
+	// Validate tokens array
+	if len(deps.Tokens) > 1000 {
+		return "deps.tokens array too large (max 1000 items)"
+	}
+
+	for i, token := range deps.Tokens {
+		if len(token) > 100 {
+			return fmt.Sprintf("deps.tokens[%d] too long (max 100 characters)", i)
+		}
+	}
+
+	return ""
+}
+
+// isValidUTF8 checks if string contains valid UTF-8
+func isValidUTF8(s string) bool {
+	for _, r := range s {
+		if r == unicode.ReplacementChar {
+			return false
+		}
+	}
+	return true
+}
+
+// languageResult builds the op's value: {"language": "en", "guesses":
+// [{"language": "en", "confidence": 0.98}, ...]} with the first
+// maxGuesses guesses. language is the best guess, or "und" when there is
+// none or it has less than minConfidence.
+func languageResult(guesses []guess, maxGuesses int) map[string]interface{} {
+	language := undetermined
+	if len(guesses) > 0 && guesses[0].Confidence >= minConfidence {
+		language = guesses[0].Language
+	}
+	list := make([]interface{}, 0, min(len(guesses), maxGuesses))
+	for i, g := range guesses {
+		if i == maxGuesses {
+			break
+		}
+		list = append(list, map[string]interface{}{
+			"language":   g.Language,
+			"confidence": g.Confidence,
+		})
+	}
+	return map[string]interface{}{
+		"language": language,
+		"guesses":  list,
+	}
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count := atomic.LoadInt64(&requestCounter)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "# HELP op_requests_total Total number of requests to /op endpoint\n")
+	fmt.Fprintf(w, "# TYPE op_requests_total counter\n")
+	fmt.Fprintf(w, "op_requests_total %d\n", count)
+}
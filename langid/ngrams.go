@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxGramLength is the length, in characters, of the longest n-grams in
+// the language profiles.
+const maxGramLength = 3
+
+// ngrams returns the n-grams of one to maxGramLength characters of every
+// word of text. Words are runs of letters and marks, lowercased and in
+// NFC, with a space on either side so that n-grams also tell how words
+// begin and end: "the" gives "t", "h", "e", " t", "th", "he", "e ", " th",
+// "the" and "he ". Scripts written without spaces make one long word.
+func ngrams(text string) []string {
+	text = norm.NFC.String(strings.ToLower(text))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r)
+	})
+
+	var grams []string
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for n := 1; n <= maxGramLength; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				if n == 1 && runes[i] == ' ' {
+					continue
+				}
+				grams = append(grams, string(runes[i:i+n]))
+			}
+		}
+	}
+	return grams
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:generate go run gen_profiles.go ngrams.go
+
+// profileFiles are the language profiles, one per ISO 639-1 code, built
+// from corpus/ by gen_profiles.go.
+//
+//go:embed profiles/*.txt
+var profileFiles embed.FS
+
+// unseenFrequency is the frequency assumed for an n-gram a profile lacks,
+// below that of an n-gram seen once in any corpus.
+const unseenFrequency = 1e-5
+
+// temperature divides the log-likelihoods before they become confidences.
+// Neighbouring n-grams share letters, so every letter is counted about
+// maxGramLength times, and the letters of a word are far from independent
+// draws themselves: untempered, a five-letter word is identified with
+// near certainty. The factor of two was chosen so that, on sentences held
+// out of the corpus, the confidence of the best guess roughly matches how
+// often it is right.
+const temperature = 2 * maxGramLength
+
+// profile holds, for one language, the log of the share of every n-gram
+// among the n-grams of its corpus.
+type profile struct {
+	language       string
+	logFrequencies map[string]float64
+}
+
+var profiles []profile
+
+func loadProfiles() error {
+	entries, err := profileFiles.ReadDir("profiles")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		data, err := profileFiles.ReadFile(path.Join("profiles", entry.Name()))
+		if err != nil {
+			return err
+		}
+		p, err := parseProfile(strings.TrimSuffix(entry.Name(), ".txt"), data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		profiles = append(profiles, p)
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("no language profiles")
+	}
+	return nil
+}
+
+// parseProfile reads a profile written by gen_profiles.go: a "# total N"
+// line, then an n-gram and its count per line.
+func parseProfile(language string, data []byte) (profile, error) {
+	p := profile{language: language, logFrequencies: make(map[string]float64)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var total float64
+	for line := 1; scanner.Scan(); line++ {
+		if line == 1 {
+			n, err := strconv.Atoi(strings.TrimPrefix(scanner.Text(), "# total "))
+			if err != nil || n <= 0 {
+				return p, fmt.Errorf("line 1: want \"# total N\"")
+			}
+			total = float64(n)
+			continue
+		}
+		gram, value, ok := strings.Cut(scanner.Text(), "\t")
+		count, err := strconv.Atoi(value)
+		if !ok || err != nil || count <= 0 {
+			return p, fmt.Errorf("line %d: want an n-gram and its count", line)
+		}
+		p.logFrequencies[gram] = math.Log(float64(count) / total)
+	}
+	return p, scanner.Err()
+}
+
+// guess is a language a text may be in.
+type guess struct {
+	Language   string
+	Confidence float64
+}
+
+// identify ranks the languages of the profiles by how likely text is in
+// each of them, most likely first. Every n-gram of text counts as a draw
+// from the language's n-gram frequencies, and the confidences are the
+// resulting probabilities, tempered by temperature, with every language
+// equally likely beforehand. N-grams no profile knows, such as those of
+// another script, tell nothing and are skipped; with none left, identify
+// returns nil.
+func identify(text string) []guess {
+	scores := make([]float64, len(profiles))
+	known := 0
+	for _, gram := range ngrams(text) {
+		if !isKnown(gram) {
+			continue
+		}
+		known++
+		for i, p := range profiles {
+			logFrequency, ok := p.logFrequencies[gram]
+			if !ok {
+				logFrequency = math.Log(unseenFrequency)
+			}
+			scores[i] += logFrequency
+		}
+	}
+	if known == 0 {
+		return nil
+	}
+
+	// Subtracting the best score keeps math.Exp from underflowing.
+	best := scores[0]
+	for _, score := range scores {
+		best = math.Max(best, score)
+	}
+	guesses := make([]guess, len(profiles))
+	sum := 0.0
+	for i, p := range profiles {
+		likelihood := math.Exp((scores[i] - best) / temperature)
+		guesses[i] = guess{Language: p.language, Confidence: likelihood}
+		sum += likelihood
+	}
+	for i := range guesses {
+		guesses[i].Confidence /= sum
+	}
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Confidence > guesses[j].Confidence
+	})
+	return guesses
+}
+
+// isKnown reports whether any profile has gram.
+func isKnown(gram string) bool {
+	for _, p := range profiles {
+		if _, ok := p.logFrequencies[gram]; ok {
+			return true
+		}
+	}
+	return false
+}
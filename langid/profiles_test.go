@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if err := loadProfiles(); err != nil {
+		log.Fatalf("Loading language profiles: %v", err)
+	}
+	os.Exit(m.Run())
+}
+
+// heldOut are sentences that are not in corpus/, so the profiles have not
+// seen them.
+var heldOut = map[string][]string{
+	"ar": {"أين محطة القطار؟", "أريد فنجان قهوة.", "الأطفال يلعبون في الحديقة."},
+	"cs": {"Kde je nádraží?", "Dal bych si šálek kávy.", "Děti si hrají na zahradě."},
+	"de": {"Wo ist der Bahnhof?", "Ich hätte gern eine Tasse Kaffee.", "Die Kinder spielen im Garten."},
+	"el": {"Πού είναι ο σταθμός;", "Θα ήθελα ένα φλιτζάνι καφέ.", "Τα παιδιά παίζουν στον κήπο."},
+	"en": {"Where is the station?", "I would like a cup of coffee, please.", "The children are playing in the garden."},
+	"es": {"¿Dónde está la estación?", "Quisiera una taza de café.", "Los niños juegan en el jardín."},
+	"fi": {"Missä rautatieasema on?", "Haluaisin kupin kahvia.", "Lapset leikkivät puutarhassa."},
+	"fr": {"Où est la gare ?", "Je voudrais une tasse de café.", "Les enfants jouent dans le jardin."},
+	"he": {"איפה תחנת הרכבת?", "אני רוצה כוס קפה.", "הילדים משחקים בגינה."},
+	"hi": {"रेलवे स्टेशन कहाँ है?", "मुझे एक कप कॉफ़ी चाहिए।", "बच्चे बगीचे में खेल रहे हैं।"},
+	"hu": {"Hol van a pályaudvar?", "Kérek egy csésze kávét.", "A gyerekek a kertben játszanak."},
+	"id": {"Di mana stasiunnya?", "Saya mau secangkir kopi.", "Anak-anak bermain di kebun."},
+	"it": {"Dov'è la stazione?", "Vorrei una tazza di caffè.", "I bambini giocano in giardino."},
+	"ja": {"駅はどこですか。", "コーヒーを一杯ください。", "子どもたちは庭で遊んでいます。"},
+	"ko": {"기차역이 어디에 있어요?", "커피 한 잔 주세요.", "아이들이 정원에서 놀고 있어요."},
+	"nl": {"Waar is het station?", "Ik wil graag een kopje koffie.", "De kinderen spelen in de tuin."},
+	"pl": {"Gdzie jest dworzec?", "Poproszę filiżankę kawy.", "Dzieci bawią się w ogrodzie."},
+	"pt": {"Onde fica a estação?", "Eu queria uma xícara de café.", "As crianças brincam no jardim."},
+	"ro": {"Aș dori o ceașcă de cafea.", "Copiii se joacă în grădină.", "Unde este gara din oraș?"},
+	"ru": {"Где вокзал?", "Я хотел бы чашку кофе.", "Дети играют в саду."},
+	"sv": {"Var ligger stationen?", "Jag skulle vilja ha en kopp kaffe.", "Barnen leker i trädgården."},
+	"tr": {"İstasyon nerede?", "Bir fincan kahve istiyorum.", "Çocuklar bahçede oynuyor."},
+	"uk": {"Де знаходиться вокзал?", "Я хотів би чашку кави.", "Діти граються в саду."},
+	"zh": {"火车站在哪里？", "我想要一杯咖啡。", "孩子们在花园里玩。"},
+}
+
+func TestIdentifyHeldOut(t *testing.T) {
+	if len(heldOut) != len(profiles) {
+		t.Fatalf("%d languages held out for %d profiles", len(heldOut), len(profiles))
+	}
+	for language, sentences := range heldOut {
+		for _, sentence := range sentences {
+			result := languageResult(identify(sentence), defaultMaxGuesses)
+			if result["language"] != language {
+				t.Errorf("%q: got %v, want %s", sentence, result, language)
+			}
+		}
+	}
+}
+
+// A single short word says little, and must not be reported with the
+// confidence of a sentence.
+func TestIdentifyShortTextUndetermined(t *testing.T) {
+	guesses := identify("Hello")
+	if len(guesses) == 0 || guesses[0].Confidence >= minConfidence {
+		t.Fatalf("Hello: got %v, want guesses below %v", guesses, minConfidence)
+	}
+	if result := languageResult(guesses, defaultMaxGuesses); result["language"] != undetermined {
+		t.Errorf("Hello: language = %v, want %s", result["language"], undetermined)
+	}
+}
+
+func TestIdentifyNoLetters(t *testing.T) {
+	if guesses := identify("1234 !?"); guesses != nil {
+		t.Errorf("got %v, want no guesses", guesses)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -37,9 +38,19 @@ type ValidationResult struct {
 var requestCounter int64
 
 func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+
 	http.HandleFunc("/op", handleOp)
 	http.HandleFunc("/healthz", handleHealth)
 	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
 
 	log.Println("Starting server on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -57,17 +68,30 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 	var req OpRequest
 	var validationResult ValidationResult
 
-	// Parse and validate JSON
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
 		validationResult = ValidationResult{
 			Valid: false,
-			Error: fmt.Sprintf("Invalid JSON: %s", err.Error()),
+			Error: err.Error(),
 		}
 	} else {
 		validationResult = validateInput(req)
 	}
 
-	// Process based on validation result
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
 	var normalizedValue interface{}
 	var errorMsg string
 
@@ -99,9 +123,7 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 		response.Error = errorMsg
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	return response
 }
 
 // validateInput performs comprehensive input validation
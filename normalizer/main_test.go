@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestNormalizeTextCases checks normalizeText against
+// testdata/normalize.json. The hasher and the aggregator's fallback keep
+// copies of normalizeText and check them against the same file, so a
+// change here must update the file, and then the copies.
+func TestNormalizeTextCases(t *testing.T) {
+	data, err := os.ReadFile("testdata/normalize.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Text       string `json:"text"`
+		Normalized string `json:"normalized"`
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if got := normalizeText(c.Text); got != c.Normalized {
+			t.Errorf("normalizeText(%q) = %q, want %q", c.Text, got, c.Normalized)
+		}
+	}
+}
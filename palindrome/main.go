@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+type OpRequest struct {
+	Text *string `json:"text,omitempty"`
+	Deps *struct {
+		Normalized     *string  `json:"normalized,omitempty"`
+		Transliterated *string  `json:"transliterated,omitempty"`
+		Tokens         []string `json:"tokens,omitempty"`
+	} `json:"deps,omitempty"`
+}
+
+type OpResponse struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+	CacheHit bool        `json:"cache_hit"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type ValidationResult struct {
+	Valid bool
+	Error string
+}
+
+// Global request counter
+var requestCounter int64
+
+func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+
+	http.HandleFunc("/op", handleOp)
+	http.HandleFunc("/healthz", handleHealth)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting palindrome gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
+
+	log.Println("Starting palindrome server on :8080...")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+func handleOp(w http.ResponseWriter, r *http.Request) {
+	// Increment request counter
+	atomic.AddInt64(&requestCounter, 1)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req OpRequest
+	var validationResult ValidationResult
+
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
+		validationResult = ValidationResult{
+			Valid: false,
+			Error: err.Error(),
+		}
+	} else {
+		validationResult = validateInput(req)
+	}
+
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
+	var palindromeValue interface{}
+	var errorMsg string
+
+	if !validationResult.Valid {
+		palindromeValue = nil
+		errorMsg = validationResult.Error
+	} else {
+		// Use deps.normalized if available, otherwise use text
+		var inputText string
+		var hasInput bool
+
+		if req.Deps != nil && req.Deps.Normalized != nil && *req.Deps.Normalized != "" {
+			inputText = *req.Deps.Normalized
+			hasInput = true
+		} else if req.Text != nil && *req.Text != "" {
+			inputText = *req.Text
+			hasInput = true
+		}
+
+		if hasInput {
+			// Additional runtime validation
+			if len(inputText) > 10000 {
+				palindromeValue = nil
+				errorMsg = "Input text too long (max 10000 characters)"
+			} else {
+				palindromeValue = palindromeResult(inputText)
+			}
+		} else {
+			palindromeValue = nil
+			errorMsg = "No normalized text in deps or text provided"
+		}
+	}
+
+	response := OpResponse{
+		Key:      "palindrome",
+		Value:    palindromeValue,
+		CacheHit: false,
+	}
+
+	// Include error message if present
+	if errorMsg != "" {
+		response.Error = errorMsg
+	}
+
+	return response
+}
+
+// validateInput performs comprehensive input validation
+func validateInput(req OpRequest) ValidationResult {
+	// Check if request is completely empty
+	if req.Text == nil && req.Deps == nil {
+		return ValidationResult{
+			Valid: false,
+			Error: "Request body must contain either 'text' or 'deps' field",
+		}
+	}
+
+	// Validate text field if present
+	if req.Text != nil {
+		if len(*req.Text) == 0 {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text field cannot be empty string",
+			}
+		}
+
+		// Check for invalid characters or encoding issues
+		if !isValidUTF8(*req.Text) {
+			return ValidationResult{
+				Valid: false,
+				Error: "Text contains invalid UTF-8 characters",
+			}
+		}
+	}
+
+	// Validate deps structure if present
+	if req.Deps != nil {
+		if err := validateDeps(*req.Deps); err != "" {
+			return ValidationResult{
+				Valid: false,
+				Error: err,
+			}
+		}
+	}
+
+	return ValidationResult{Valid: true, Error: ""}
+}
+
+// validateDeps validates the deps structure
+func validateDeps(deps struct {
+	Normalized     *string  `json:"normalized,omitempty"`
+	Transliterated *string  `json:"transliterated,omitempty"`
+	Tokens         []string `json:"tokens,omitempty"`
+}) string {
+	// Validate normalized field
+	if deps.Normalized != nil && len(*deps.Normalized) > 10000 {
+		return "deps.normalized too long (max 10000 characters)"
+	}
+
+	// Validate transliterated field
+	if deps.Transliterated != nil && len(*deps.Transliterated) > 10000 {
+		return "deps.transliterated too long (max 10000 characters)"
+	}
+
+	// Validate tokens array
+	if len(deps.Tokens) > 1000 {
+		return "deps.tokens array too large (max 1000 items)"
+	}
+
+	for i, token := range deps.Tokens {
+		if len(token) > 100 {
+			return fmt.Sprintf("deps.tokens[%d] too long (max 100 characters)", i)
+		}
+	}
+
+	return ""
+}
+
+// isValidUTF8 checks if string contains valid UTF-8
+func isValidUTF8(s string) bool {
+	for _, r := range s {
+		if r == unicode.ReplacementChar {
+			return false
+		}
+	}
+	return true
+}
+
+// cluster is a grapheme cluster of the text, at bytes [start, end).
+type cluster struct {
+	start, end int
+}
+
+// palindromeResult builds the op's value: whether text reads the same both
+// ways, and the longest palindrome in it. Both compare grapheme clusters,
+// so combining marks and emoji sequences stay whole, and skip clusters of
+// punctuation or spaces. Clusters are compared lowercased and in NFC.
+// start and end are the byte offsets of longest in text.
+func palindromeResult(text string) map[string]interface{} {
+	var clusters []cluster
+	var symbols []int
+	ids := make(map[string]int)
+	offset := 0
+	rest := text
+	state := -1
+	for len(rest) > 0 {
+		var c string
+		c, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		start := offset
+		offset += len(c)
+		if isIgnored(c) {
+			continue
+		}
+		key := norm.NFC.String(strings.ToLower(c))
+		id, ok := ids[key]
+		if !ok {
+			id = len(ids)
+			ids[key] = id
+		}
+		clusters = append(clusters, cluster{start: start, end: offset})
+		symbols = append(symbols, id)
+	}
+
+	first, last := longestPalindrome(symbols)
+	start, end := 0, 0
+	if last > first {
+		start, end = clusters[first].start, clusters[last-1].end
+	}
+	return map[string]interface{}{
+		"is_palindrome": len(symbols) > 0 && last-first == len(symbols),
+		"longest":       text[start:end],
+		"start":         start,
+		"end":           end,
+	}
+}
+
+// isIgnored reports whether a cluster is punctuation or space.
+func isIgnored(c string) bool {
+	r, _ := utf8.DecodeRuneInString(c)
+	return unicode.IsPunct(r) || unicode.IsSpace(r)
+}
+
+// longestPalindrome returns the range [first, last) of the leftmost
+// longest palindrome in s, in linear time with Manacher's algorithm.
+func longestPalindrome(s []int) (first, last int) {
+	// t puts a separator, -1, around every symbol so that palindromes of
+	// even length are centred on one too. radius[i] is then both how far
+	// the palindrome centred on t[i] reaches and its length in s.
+	t := make([]int, 2*len(s)+1)
+	for i := range t {
+		t[i] = -1
+	}
+	for i, symbol := range s {
+		t[2*i+1] = symbol
+	}
+
+	radius := make([]int, len(t))
+	center, right, best := 0, 0, 0
+	for i := range t {
+		// Within the palindrome reaching furthest right, i mirrors
+		// 2*center-i, so it reaches at least as far, up to right.
+		if i < right {
+			radius[i] = min(right-i, radius[2*center-i])
+		}
+		for i-radius[i] > 0 && i+radius[i] < len(t)-1 && t[i-radius[i]-1] == t[i+radius[i]+1] {
+			radius[i]++
+		}
+		if i+radius[i] > right {
+			center, right = i, i+radius[i]
+		}
+		if radius[i] > radius[best] {
+			best = i
+		}
+	}
+
+	first = (best - radius[best]) / 2
+	return first, first + radius[best]
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count := atomic.LoadInt64(&requestCounter)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "# HELP op_requests_total Total number of requests to /op endpoint\n")
+	fmt.Fprintf(w, "# TYPE op_requests_total counter\n")
+	fmt.Fprintf(w, "op_requests_total %d\n", count)
+}
@@ -0,0 +1,50 @@
+#!/usr/bin/env bash
+
+# Regenerates the Go code for the protobuf definitions under proto/ into
+# every service that uses them. Each service is its own module, so each gets
+# its own copy: <service>/oppb for the op API and aggregator/aggregatorpb for
+# the aggregator API.
+#
+# Needs protoc, protoc-gen-go and protoc-gen-go-grpc in PATH.
+
+set -euo pipefail
+
+for tool in protoc protoc-gen-go protoc-gen-go-grpc; do
+  if ! command -v "$tool" >/dev/null 2>&1; then
+    printf '%s executable not found in PATH\n' "$tool" >&2
+    exit 1
+  fi
+done
+
+PROTO_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+ROOT_DIR="$(dirname "$PROTO_DIR")"
+
+# generate <proto file> <service dir> <Go package dir>
+generate() {
+  local proto="$1"
+  local service_dir="$ROOT_DIR/$2"
+  local package_dir="$3"
+
+  local module
+  module="$(awk '$1 == "module" { print $2; exit }' "$service_dir/go.mod")"
+
+  printf 'Generating %s into %s/%s\n' "$proto" "$2" "$package_dir"
+  protoc -I "$PROTO_DIR" \
+    --go_out="$service_dir" --go_opt="module=$module" \
+    --go_opt="M$proto=$module/$package_dir" \
+    --go-grpc_out="$service_dir" --go-grpc_opt="module=$module" \
+    --go-grpc_opt="M$proto=$module/$package_dir" \
+    "$PROTO_DIR/$proto"
+}
+
+generate op/v1/op.proto normalizer oppb
+generate op/v1/op.proto transliterator oppb
+generate op/v1/op.proto slugger oppb
+generate op/v1/op.proto tokenizer oppb
+generate op/v1/op.proto counter oppb
+generate op/v1/op.proto hasher oppb
+generate op/v1/op.proto entropy oppb
+generate op/v1/op.proto palindrome oppb
+generate op/v1/op.proto langid oppb
+generate op/v1/op.proto aggregator oppb
+generate aggregator/v1/aggregator.proto aggregator aggregatorpb
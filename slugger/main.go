@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"regexp"
@@ -18,6 +19,10 @@ type OpRequest struct {
 		Transliterated *string  `json:"transliterated,omitempty"`
 		Tokens         []string `json:"tokens,omitempty"`
 	} `json:"deps,omitempty"`
+	Options *struct {
+		// MaxLength caps the slug length, 64 by default.
+		MaxLength *int `json:"max_length,omitempty"`
+	} `json:"options,omitempty"`
 }
 
 type OpResponse struct {
@@ -27,6 +32,9 @@ type OpResponse struct {
 	Error    string      `json:"error,omitempty"`
 }
 
+// maxSlugLength is the longest slug generated, and the default length.
+const maxSlugLength = 64
+
 type ValidationResult struct {
 	Valid bool
 	Error string
@@ -36,9 +44,19 @@ type ValidationResult struct {
 var requestCounter int64
 
 func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+
 	http.HandleFunc("/op", handleOp)
 	http.HandleFunc("/healthz", handleHealth)
 	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting slugger gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
 
 	log.Println("Starting slugger server on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -56,17 +74,30 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 	var req OpRequest
 	var validationResult ValidationResult
 
-	// Parse and validate JSON
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
 		validationResult = ValidationResult{
 			Valid: false,
-			Error: fmt.Sprintf("Invalid JSON: %s", err.Error()),
+			Error: err.Error(),
 		}
 	} else {
 		validationResult = validateInput(req)
 	}
 
-	// Process based on validation result
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
 	var slugValue interface{}
 	var errorMsg string
 
@@ -92,7 +123,11 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 				slugValue = nil
 				errorMsg = "Input text too long (max 10000 characters)"
 			} else {
-				slug := generateSlug(inputText)
+				maxLen := maxSlugLength
+				if req.Options != nil && req.Options.MaxLength != nil {
+					maxLen = *req.Options.MaxLength
+				}
+				slug := generateSlug(inputText, maxLen)
 				if slug == "" {
 					slugValue = nil
 					errorMsg = "No valid characters found for slug generation"
@@ -117,9 +152,7 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 		response.Error = errorMsg
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	return response
 }
 
 // validateInput performs comprehensive input validation
@@ -160,6 +193,16 @@ func validateInput(req OpRequest) ValidationResult {
 		}
 	}
 
+	// Validate options if present
+	if req.Options != nil && req.Options.MaxLength != nil {
+		if *req.Options.MaxLength < 1 || *req.Options.MaxLength > maxSlugLength {
+			return ValidationResult{
+				Valid: false,
+				Error: fmt.Sprintf("options.max_length must be between 1 and %d", maxSlugLength),
+			}
+		}
+	}
+
 	return ValidationResult{Valid: true, Error: ""}
 }
 
@@ -203,8 +246,8 @@ func isValidUTF8(s string) bool {
 	return true
 }
 
-// generateSlug creates a URL-friendly slug from input text
-func generateSlug(s string) string {
+// generateSlug creates a URL-friendly slug of at most maxLen characters from input text
+func generateSlug(s string, maxLen int) string {
 	// Convert to lowercase
 	text := strings.ToLower(s)
 
@@ -230,14 +273,14 @@ func generateSlug(s string) string {
 	// Join words with hyphens
 	slug := strings.Join(validWords, "-")
 
-	// Ensure max 64 characters
-	if len(slug) > 64 {
+	// Ensure max maxLen characters
+	if len(slug) > maxLen {
 		// Try to truncate at word boundaries
-		slug = truncateSlugAtWordBoundary(slug, 64)
+		slug = truncateSlugAtWordBoundary(slug, maxLen)
 
 		// If still too long, hard truncate
-		if len(slug) > 64 {
-			slug = slug[:64]
+		if len(slug) > maxLen {
+			slug = slug[:maxLen]
 			// Remove trailing hyphen if present
 			slug = strings.TrimSuffix(slug, "-")
 		}
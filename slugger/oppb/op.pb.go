@@ -0,0 +1,235 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: op/v1/op.proto
+
+// Package disablers.op.v1 is the gRPC form of the /op endpoint every op
+// service serves. Messages mirror the JSON OpRequest and OpResponse.
+
+package oppb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type OpRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Text  *string                `protobuf:"bytes,1,opt,name=text,proto3,oneof" json:"text,omitempty"`
+	// Values of other ops, keyed by their output key, e.g. "normalized".
+	Deps *structpb.Struct `protobuf:"bytes,2,opt,name=deps,proto3" json:"deps,omitempty"`
+	// Per-request settings of the op, e.g. {"max_length": 20} for the
+	// slugger. Each op publishes the settings it takes in its OpenAPI
+	// document; a setting it does not know is reported in OpResponse.error.
+	Options       *structpb.Struct `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpRequest) Reset() {
+	*x = OpRequest{}
+	mi := &file_op_v1_op_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpRequest) ProtoMessage() {}
+
+func (x *OpRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_op_v1_op_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpRequest.ProtoReflect.Descriptor instead.
+func (*OpRequest) Descriptor() ([]byte, []int) {
+	return file_op_v1_op_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *OpRequest) GetText() string {
+	if x != nil && x.Text != nil {
+		return *x.Text
+	}
+	return ""
+}
+
+func (x *OpRequest) GetDeps() *structpb.Struct {
+	if x != nil {
+		return x.Deps
+	}
+	return nil
+}
+
+func (x *OpRequest) GetOptions() *structpb.Struct {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type OpResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Null when the op failed.
+	Value         *structpb.Value `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	CacheHit      bool            `protobuf:"varint,3,opt,name=cache_hit,json=cacheHit,proto3" json:"cache_hit,omitempty"`
+	Error         string          `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpResponse) Reset() {
+	*x = OpResponse{}
+	mi := &file_op_v1_op_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpResponse) ProtoMessage() {}
+
+func (x *OpResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_op_v1_op_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpResponse.ProtoReflect.Descriptor instead.
+func (*OpResponse) Descriptor() ([]byte, []int) {
+	return file_op_v1_op_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *OpResponse) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *OpResponse) GetValue() *structpb.Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *OpResponse) GetCacheHit() bool {
+	if x != nil {
+		return x.CacheHit
+	}
+	return false
+}
+
+func (x *OpResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_op_v1_op_proto protoreflect.FileDescriptor
+
+const file_op_v1_op_proto_rawDesc = "" +
+	"\n" +
+	"\x0eop/v1/op.proto\x12\x0fdisablers.op.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x8d\x01\n" +
+	"\tOpRequest\x12\x17\n" +
+	"\x04text\x18\x01 \x01(\tH\x00R\x04text\x88\x01\x01\x12+\n" +
+	"\x04deps\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x04deps\x121\n" +
+	"\aoptions\x18\x03 \x01(\v2\x17.google.protobuf.StructR\aoptionsB\a\n" +
+	"\x05_text\"\x7f\n" +
+	"\n" +
+	"OpResponse\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12,\n" +
+	"\x05value\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05value\x12\x1b\n" +
+	"\tcache_hit\x18\x03 \x01(\bR\bcacheHit\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error2D\n" +
+	"\x02Op\x12>\n" +
+	"\x03Run\x12\x1a.disablers.op.v1.OpRequest\x1a\x1b.disablers.op.v1.OpResponseb\x06proto3"
+
+var (
+	file_op_v1_op_proto_rawDescOnce sync.Once
+	file_op_v1_op_proto_rawDescData []byte
+)
+
+func file_op_v1_op_proto_rawDescGZIP() []byte {
+	file_op_v1_op_proto_rawDescOnce.Do(func() {
+		file_op_v1_op_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_op_v1_op_proto_rawDesc), len(file_op_v1_op_proto_rawDesc)))
+	})
+	return file_op_v1_op_proto_rawDescData
+}
+
+var file_op_v1_op_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_op_v1_op_proto_goTypes = []any{
+	(*OpRequest)(nil),       // 0: disablers.op.v1.OpRequest
+	(*OpResponse)(nil),      // 1: disablers.op.v1.OpResponse
+	(*structpb.Struct)(nil), // 2: google.protobuf.Struct
+	(*structpb.Value)(nil),  // 3: google.protobuf.Value
+}
+var file_op_v1_op_proto_depIdxs = []int32{
+	2, // 0: disablers.op.v1.OpRequest.deps:type_name -> google.protobuf.Struct
+	2, // 1: disablers.op.v1.OpRequest.options:type_name -> google.protobuf.Struct
+	3, // 2: disablers.op.v1.OpResponse.value:type_name -> google.protobuf.Value
+	0, // 3: disablers.op.v1.Op.Run:input_type -> disablers.op.v1.OpRequest
+	1, // 4: disablers.op.v1.Op.Run:output_type -> disablers.op.v1.OpResponse
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_op_v1_op_proto_init() }
+func file_op_v1_op_proto_init() {
+	if File_op_v1_op_proto != nil {
+		return
+	}
+	file_op_v1_op_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_op_v1_op_proto_rawDesc), len(file_op_v1_op_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_op_v1_op_proto_goTypes,
+		DependencyIndexes: file_op_v1_op_proto_depIdxs,
+		MessageInfos:      file_op_v1_op_proto_msgTypes,
+	}.Build()
+	File_op_v1_op_proto = out.File
+	file_op_v1_op_proto_goTypes = nil
+	file_op_v1_op_proto_depIdxs = nil
+}
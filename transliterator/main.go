@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -19,7 +20,14 @@ type OpRequest struct {
 		Normalized     *string  `json:"normalized,omitempty"`
 		Transliterated *string  `json:"transliterated,omitempty"`
 		Tokens         []string `json:"tokens,omitempty"`
+		// Language is the ISO 639-1 code of the text's language.
+		Language *string `json:"language,omitempty"`
 	} `json:"deps,omitempty"`
+	Options *struct {
+		// Standard names one of the transliteration standards, "basic" by
+		// default, or autoStandard.
+		Standard *string `json:"standard,omitempty"`
+	} `json:"options,omitempty"`
 }
 
 type OpResponse struct {
@@ -38,9 +46,19 @@ type ValidationResult struct {
 var requestCounter int64
 
 func main() {
+	if err := loadOpenAPI(); err != nil {
+		log.Fatalf("Loading OpenAPI document: %v", err)
+	}
+
 	http.HandleFunc("/op", handleOp)
 	http.HandleFunc("/healthz", handleHealth)
 	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+
+	go func() {
+		log.Println("Starting transliterator gRPC server on :9090...")
+		log.Fatal(serveGRPC(":9090"))
+	}()
 
 	log.Println("Starting transliterator server on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -58,17 +76,30 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 	var req OpRequest
 	var validationResult ValidationResult
 
-	// Parse and validate JSON
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// Parse and validate JSON against the OpenAPI schema
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeOpRequest(body, &req)
+	}
+	if err != nil {
 		validationResult = ValidationResult{
 			Valid: false,
-			Error: fmt.Sprintf("Invalid JSON: %s", err.Error()),
+			Error: err.Error(),
 		}
 	} else {
 		validationResult = validateInput(req)
 	}
 
-	// Process based on validation result
+	response := runOp(req, validationResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runOp computes the op's response for a request that was validated with
+// validationResult. It serves both /op and the gRPC Run method.
+func runOp(req OpRequest, validationResult ValidationResult) OpResponse {
 	var transliteratedValue interface{}
 	var errorMsg string
 
@@ -94,7 +125,18 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 				transliteratedValue = nil
 				errorMsg = "Input text too long (max 10000 characters)"
 			} else {
-				transliterated := transliterateText(inputText)
+				standard := "basic"
+				if req.Options != nil && req.Options.Standard != nil {
+					standard = *req.Options.Standard
+				}
+				if standard == autoStandard {
+					// validateInput made sure deps.language is set.
+					standard = "basic"
+					if languageStandard, ok := languageStandards[*req.Deps.Language]; ok {
+						standard = languageStandard
+					}
+				}
+				transliterated := transliterateText(inputText, standard)
 				transliteratedValue = transliterated
 			}
 		} else {
@@ -114,9 +156,7 @@ func handleOp(w http.ResponseWriter, r *http.Request) {
 		response.Error = errorMsg
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	return response
 }
 
 // validateInput performs comprehensive input validation
@@ -157,6 +197,23 @@ func validateInput(req OpRequest) ValidationResult {
 		}
 	}
 
+	// Validate options if present
+	if req.Options != nil && req.Options.Standard != nil {
+		if _, ok := standards[*req.Options.Standard]; !ok && *req.Options.Standard != autoStandard {
+			return ValidationResult{
+				Valid: false,
+				Error: fmt.Sprintf("Unknown transliteration standard %q", *req.Options.Standard),
+			}
+		}
+		if *req.Options.Standard == autoStandard &&
+			(req.Deps == nil || req.Deps.Language == nil || *req.Deps.Language == "") {
+			return ValidationResult{
+				Valid: false,
+				Error: fmt.Sprintf("Standard %q needs deps.language", autoStandard),
+			}
+		}
+	}
+
 	return ValidationResult{Valid: true, Error: ""}
 }
 
@@ -165,6 +222,8 @@ func validateDeps(deps struct {
 	Normalized     *string  `json:"normalized,omitempty"`
 	Transliterated *string  `json:"transliterated,omitempty"`
 	Tokens         []string `json:"tokens,omitempty"`
+	// Language is the ISO 639-1 code of the text's language.
+	Language *string `json:"language,omitempty"`
 }) string {
 	// Validate normalized field
 	if deps.Normalized != nil && len(*deps.Normalized) > 10000 {
@@ -201,16 +260,23 @@ func isValidUTF8(s string) bool {
 }
 
 // transliterateText performs ASCII-ish transliteration with ligature replacement
-func transliterateText(s string) string {
-	// First normalize using NFD to decompose characters
-	normalized := norm.NFD.String(s)
+func transliterateText(s string, standard string) string {
+	// Apply the standard's mappings while letters such as й are still
+	// composed; they are applied again below once diacritics are gone
+	text := applyStandard(norm.NFC.String(s), standard)
+
+	// Normalize using NFD to decompose characters
+	normalized := norm.NFD.String(text)
 
 	// Replace common ligatures first
-	text := replaceLigatures(normalized)
+	text = replaceLigatures(normalized)
 
 	// Remove diacritics by filtering out combining marks
 	text = removeDiacritics(text)
 
+	// Apply the standard's mappings before the generic ones
+	text = applyStandard(text, standard)
+
 	// Apply additional ASCII transliterations
 	text = applyASCIITransliterations(text)
 
@@ -282,6 +348,128 @@ func applyASCIITransliterations(s string) string {
 	return result.String()
 }
 
+// transliterationStandard maps letters of one script to ASCII. Digraphs
+// are replaced before single letters. Tables are lowercase: an uppercase
+// letter gets its replacement capitalised, and a digraph keeps the case
+// of its letters (see matchCase).
+type transliterationStandard struct {
+	digraphs [][2]string
+	letters  map[rune]string
+}
+
+// standards are the transliteration standards a request can pick with
+// options.standard. "basic" only applies the generic mappings.
+var standards = map[string]transliterationStandard{
+	"basic": {},
+	// ELOT 743 for Greek, without the context-dependent rules.
+	"elot743": {
+		digraphs: [][2]string{
+			{"ου", "ou"}, {"αυ", "av"}, {"ευ", "ev"}, {"γγ", "ng"},
+		},
+		letters: map[rune]string{
+			'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e",
+			'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+			'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o",
+			'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+			'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+		},
+	},
+	// BGN/PCGN for Russian, without the apostrophes for hard and soft
+	// signs.
+	"bgn-pcgn": {
+		letters: map[rune]string{
+			'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d",
+			'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+			'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+			'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+			'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch",
+			'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+			'э': "e", 'ю': "yu", 'я': "ya",
+		},
+	},
+}
+
+// autoStandard asks for the standard of the text's language, from
+// deps.language, and "basic" for languages without one, such as "und".
+// Requests for it without deps.language are rejected. Picking by language
+// is opt-in because the language is a guess.
+const autoStandard = "auto"
+
+// languageStandards picks the standard for texts in a language when the
+// request asks for autoStandard.
+var languageStandards = map[string]string{
+	"el": "elot743",
+	"ru": "bgn-pcgn",
+}
+
+// applyStandard applies the named transliteration standard's mappings
+func applyStandard(s string, name string) string {
+	standard := standards[name]
+	if len(standard.digraphs) == 0 && len(standard.letters) == 0 {
+		return s
+	}
+
+	var result strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if replacement, n := matchDigraph(standard.digraphs, runes[i:]); n > 0 {
+			result.WriteString(matchCase(replacement, runes[i:i+n]))
+			i += n - 1
+			continue
+		}
+		r := runes[i]
+		lower := unicode.ToLower(r)
+		replacement, exists := standard.letters[lower]
+		if !exists {
+			result.WriteRune(r)
+			continue
+		}
+		if lower != r && replacement != "" {
+			replacement = strings.ToUpper(replacement[:1]) + replacement[1:]
+		}
+		result.WriteString(replacement)
+	}
+
+	return result.String()
+}
+
+// matchDigraph returns the replacement of the digraph that runes start
+// with, in any case, and the digraph's length in runes; 0 if none does.
+func matchDigraph(digraphs [][2]string, runes []rune) (string, int) {
+	for _, digraph := range digraphs {
+		from := []rune(digraph[0])
+		if len(from) > len(runes) {
+			continue
+		}
+		matched := true
+		for k, r := range from {
+			if unicode.ToLower(runes[k]) != r {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return digraph[1], len(from)
+		}
+	}
+	return "", 0
+}
+
+// matchCase gives a digraph's replacement the case of the letters it
+// replaces: uppercase when they all are, capitalised when only the first
+// one is.
+func matchCase(replacement string, from []rune) string {
+	if replacement == "" || !unicode.IsUpper(from[0]) {
+		return replacement
+	}
+	for _, r := range from[1:] {
+		if !unicode.IsUpper(r) {
+			return strings.ToUpper(replacement[:1]) + replacement[1:]
+		}
+	}
+	return strings.ToUpper(replacement)
+}
+
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)